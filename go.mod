@@ -3,11 +3,13 @@ module github.com/somememoryspace/inframon
 go 1.22.5
 
 require (
+	filippo.io/age v1.2.1
 	github.com/go-ping/ping v1.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/prometheus-community/pro-bing v0.4.1 // indirect
+	golang.org/x/crypto v0.25.0 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,288 @@
+package alerting
+
+import (
+	"fmt"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+const DefaultSeverity = "critical"
+
+type Router struct {
+	routes       []utils.RouteConfig
+	defaultRoute utils.RouteConfig
+}
+
+func NewRouter(config *utils.Config) *Router {
+	defaultRoute := config.DefaultRoute
+	if len(defaultRoute.Notifiers) == 0 {
+		defaultRoute.Notifiers = utils.ImplicitNotifierNames(config)
+	}
+	return &Router{routes: config.Routes, defaultRoute: defaultRoute}
+}
+
+// Route walks the routes in order and returns the notifiers of the first match,
+// carrying on past it only while matching routes set continue. Targets that match
+// no route fall through to the default route.
+func (r *Router) Route(target notifiers.InstanceStatus) []string {
+	names, _ := r.route(target)
+	return names
+}
+
+// Escalation returns the escalation policy of the first matched route that sets one.
+func (r *Router) Escalation(target notifiers.InstanceStatus) string {
+	_, escalation := r.route(target)
+	return escalation
+}
+
+func (r *Router) Defaults() []string {
+	return r.defaultRoute.Notifiers
+}
+
+func (r *Router) route(target notifiers.InstanceStatus) ([]string, string) {
+	var names []string
+	escalation := ""
+	matched := false
+	for _, route := range r.routes {
+		if !matches(route.Match, target) {
+			continue
+		}
+		matched = true
+		names = MergeNames(names, route.Notifiers)
+		if escalation == "" {
+			escalation = route.Escalation
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	if !matched {
+		return r.defaultRoute.Notifiers, r.defaultRoute.Escalation
+	}
+	return names, escalation
+}
+
+// TargetInstance describes a target for notifications, routes and silences.
+func TargetInstance(protocol string, target utils.TargetMeta) notifiers.InstanceStatus {
+	severity := target.Severity
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	return notifiers.InstanceStatus{
+		ID:           target.ID,
+		Address:      target.Address,
+		Service:      target.Service,
+		NetworkZone:  target.NetworkZone,
+		InstanceType: target.InstanceType,
+		Protocol:     protocol,
+		RunbookURL:   target.RunbookURL,
+		Severity:     severity,
+		Tags:         target.Tags,
+		Labels:       target.Labels,
+	}
+}
+
+// Targets describes every configured target, icmp first.
+func Targets(config *utils.Config) []notifiers.InstanceStatus {
+	var targets []notifiers.InstanceStatus
+	for _, icmp := range config.ICMP {
+		targets = append(targets, TargetInstance(icmp.Protocol(), icmp.TargetMeta))
+	}
+	for _, http := range config.HTTP {
+		targets = append(targets, TargetInstance(http.Protocol(), http.TargetMeta))
+	}
+	return targets
+}
+
+// MergeNames appends the names in extra that are not already in names.
+func MergeNames(names []string, extra []string) []string {
+	for _, name := range extra {
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func matches(match utils.RouteMatch, target notifiers.InstanceStatus) bool {
+	return Matcher{
+		Service:      match.Service,
+		NetworkZone:  match.NetworkZone,
+		InstanceType: match.InstanceType,
+		Protocol:     match.Protocol,
+		Severity:     match.Severity,
+		Tags:         match.Tags,
+		Labels:       match.Labels,
+	}.Matches(target)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildNotifiers creates the notifiers referenced by routes, keyed by name. The flat
+// `configuration` integrations are registered under their type name when enabled.
+func BuildNotifiers(config *utils.Config, templates *notifiers.Templates) (map[string]notifiers.Notifier, error) {
+	built := make(map[string]notifiers.Notifier)
+	c := config.Configuration
+
+	if !c.DiscordWebHookDisable {
+		discordConfig := notifiers.DiscordConfig{
+			WebhookURL:     c.DiscordWebHookURL,
+			ThreadID:       c.DiscordThreadID,
+			Username:       c.DiscordUsername,
+			AvatarURL:      c.DiscordAvatarURL,
+			Mentions:       c.DiscordMentions,
+			EditOnRecovery: c.DiscordEditOnRecovery,
+		}
+		built[notifiers.TypeDiscord] = notifiers.NewDiscordNotifier(notifiers.TypeDiscord, discordConfig, templates, c.HealthCronWebhookDisable)
+	}
+	if !c.SmtpDisable {
+		smtpConfig := notifiers.SMTPConfig{
+			Host:     c.SmtpHost,
+			Port:     c.SmtpPort,
+			Username: c.SmtpUsername,
+			Password: c.SmtpPassword,
+			From:     c.SmtpFrom,
+			To:       c.SmtpTo,
+			Cc:       c.SmtpCc,
+			Bcc:      c.SmtpBcc,
+			TLS:      c.SmtpTLS,
+			Auth:     c.SmtpAuth,
+		}
+		built[notifiers.TypeSMTP] = notifiers.NewSMTPNotifier(notifiers.TypeSMTP, smtpConfig, templates, c.HealthCronSmtpDisable)
+	}
+	if c.PagerDutyEnable {
+		if c.PagerDutyRoutingKey == "" {
+			if err := checkRoutingKeys(config); err != nil {
+				return nil, err
+			}
+		}
+		built[notifiers.TypePagerDuty] = notifiers.NewPagerDutyNotifier(notifiers.TypePagerDuty, c.PagerDutyURL, c.PagerDutyRoutingKey, routingKeys(config))
+	}
+	if c.AlertmanagerEnable {
+		built[notifiers.TypeAlertmanager] = notifiers.NewAlertmanagerNotifier(notifiers.TypeAlertmanager, c.AlertmanagerURL)
+	}
+	if c.OpsgenieEnable {
+		built[notifiers.TypeOpsgenie] = notifiers.NewOpsgenieNotifier(notifiers.TypeOpsgenie, c.OpsgenieURL, c.OpsgenieAPIKey, c.OpsgeniePriority)
+	}
+	if c.WebhookEnable {
+		webhook, err := notifiers.NewWebhookTemplate(c.WebhookURL, c.WebhookMethod, c.WebhookHeaders, c.WebhookBody)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook configuration: %w", err)
+		}
+		built[notifiers.TypeWebhook] = notifiers.NewWebhookNotifier(notifiers.TypeWebhook, webhook)
+	}
+	if c.MatrixEnable {
+		built[notifiers.TypeMatrix] = notifiers.NewMatrixNotifier(notifiers.TypeMatrix, c.MatrixHomeserverURL, c.MatrixAccessToken, c.MatrixRoomID)
+	}
+
+	for _, n := range config.Notifiers {
+		notifier, err := buildNotifier(n, templates, config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notifier %s: %w", n.Name, err)
+		}
+		built[n.Name] = notifier
+	}
+	return built, nil
+}
+
+// checkRoutingKeys makes sure that, without a global pagerDutyRoutingKey, every
+// target that routes or escalates to the flat PagerDuty integration sets its own.
+// Named PagerDuty notifiers always have a routingKey.
+func checkRoutingKeys(config *utils.Config) error {
+	router := NewRouter(config)
+	paged := func(target notifiers.InstanceStatus) bool {
+		names := router.Route(target)
+		if policy := router.Escalation(target); policy != "" {
+			for _, p := range config.EscalationPolicies {
+				if p.Name != policy {
+					continue
+				}
+				for _, step := range p.Steps {
+					names = MergeNames(names, step.Notifiers)
+				}
+			}
+		}
+		return contains(names, notifiers.TypePagerDuty)
+	}
+	for i, icmp := range config.ICMP {
+		if icmp.PagerDutyRoutingKey == "" && paged(TargetInstance(icmp.Protocol(), icmp.TargetMeta)) {
+			return fmt.Errorf("icmp config at index %d is routed to pagerduty but has empty pagerDutyRoutingKey and no global pagerDutyRoutingKey is set", i)
+		}
+	}
+	for i, http := range config.HTTP {
+		if http.PagerDutyRoutingKey == "" && paged(TargetInstance(http.Protocol(), http.TargetMeta)) {
+			return fmt.Errorf("http config at index %d is routed to pagerduty but has empty pagerDutyRoutingKey and no global pagerDutyRoutingKey is set", i)
+		}
+	}
+	return nil
+}
+
+// routingKeys indexes the pagerDutyRoutingKey of the targets that set one by
+// target id. It is shared by every PagerDuty notifier.
+func routingKeys(config *utils.Config) map[string]string {
+	keys := make(map[string]string)
+	for _, icmp := range config.ICMP {
+		if icmp.PagerDutyRoutingKey != "" {
+			keys[icmp.ID] = icmp.PagerDutyRoutingKey
+		}
+	}
+	for _, http := range config.HTTP {
+		if http.PagerDutyRoutingKey != "" {
+			keys[http.ID] = http.PagerDutyRoutingKey
+		}
+	}
+	return keys
+}
+
+func buildNotifier(n utils.NotifierConfig, templates *notifiers.Templates, config *utils.Config) (notifiers.Notifier, error) {
+	switch n.Type {
+	case notifiers.TypeDiscord:
+		discordConfig := notifiers.DiscordConfig{
+			WebhookURL:     n.URL,
+			ThreadID:       n.ThreadID,
+			Username:       n.Username,
+			AvatarURL:      n.AvatarURL,
+			Mentions:       n.Mentions,
+			EditOnRecovery: n.EditOnRecovery,
+		}
+		return notifiers.NewDiscordNotifier(n.Name, discordConfig, templates, n.SummaryDisable), nil
+	case notifiers.TypeSMTP:
+		smtpConfig := notifiers.SMTPConfig{
+			Host:     n.Host,
+			Port:     n.Port,
+			Username: n.Username,
+			Password: n.Password,
+			From:     n.From,
+			To:       n.To,
+			Cc:       n.Cc,
+			Bcc:      n.Bcc,
+			TLS:      n.TLS,
+			Auth:     n.Auth,
+		}
+		return notifiers.NewSMTPNotifier(n.Name, smtpConfig, templates, n.SummaryDisable), nil
+	case notifiers.TypePagerDuty:
+		return notifiers.NewPagerDutyNotifier(n.Name, n.URL, n.RoutingKey, routingKeys(config)), nil
+	case notifiers.TypeAlertmanager:
+		return notifiers.NewAlertmanagerNotifier(n.Name, n.URL), nil
+	case notifiers.TypeOpsgenie:
+		return notifiers.NewOpsgenieNotifier(n.Name, n.URL, n.APIKey, n.Priority), nil
+	case notifiers.TypeWebhook:
+		webhook, err := notifiers.NewWebhookTemplate(n.URL, n.Method, n.Headers, n.Body)
+		if err != nil {
+			return nil, err
+		}
+		return notifiers.NewWebhookNotifier(n.Name, webhook), nil
+	case notifiers.TypeMatrix:
+		return notifiers.NewMatrixNotifier(n.Name, n.URL, n.AccessToken, n.RoomID), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %s", n.Type)
+	}
+}
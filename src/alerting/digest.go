@@ -0,0 +1,52 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+)
+
+const DefaultDigestMaxEvents = 100
+
+// Digest holds back transitions per notifier for a window that starts with the
+// first one, then hands them to send as a single digest. A window that only
+// caught one transition sends it unchanged.
+type Digest struct {
+	mu        sync.Mutex
+	window    time.Duration
+	maxEvents int
+	send      func(name string, event notifiers.Event)
+	pending   map[string][]notifiers.Event
+}
+
+func NewDigest(window time.Duration, maxEvents int, send func(name string, event notifiers.Event)) *Digest {
+	if maxEvents <= 0 {
+		maxEvents = DefaultDigestMaxEvents
+	}
+	return &Digest{window: window, maxEvents: maxEvents, send: send, pending: make(map[string][]notifiers.Event)}
+}
+
+func (d *Digest) Add(name string, event notifiers.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending[name]) == 0 {
+		time.AfterFunc(d.window, func() { d.flush(name) })
+	}
+	d.pending[name] = append(d.pending[name], event)
+}
+
+func (d *Digest) flush(name string) {
+	d.mu.Lock()
+	events := d.pending[name]
+	delete(d.pending, name)
+	d.mu.Unlock()
+
+	switch len(events) {
+	case 0:
+	case 1:
+		d.send(name, events[0])
+	default:
+		d.send(name, notifiers.NewDigestEvent(events, d.maxEvents))
+	}
+}
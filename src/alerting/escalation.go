@@ -0,0 +1,149 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+const EscalationTitle = "Connection Still Interrupted"
+
+type EscalationStep struct {
+	After     time.Duration
+	Repeat    time.Duration
+	Notifiers []string
+}
+
+type Escalation struct {
+	Key       string
+	Step      int
+	Notifiers []string
+	Event     notifiers.Event
+}
+
+type Alert struct {
+	Key      string          `json:"key"`
+	Event    notifiers.Event `json:"event"`
+	Notified []string        `json:"notified"`
+}
+
+type escalationState struct {
+	event    notifiers.Event
+	steps    []EscalationStep
+	next     []time.Time
+	notified []string
+}
+
+type Escalator struct {
+	mu       sync.Mutex
+	policies map[string][]EscalationStep
+	active   map[string]*escalationState
+}
+
+func NewEscalator(config *utils.Config) *Escalator {
+	policies := make(map[string][]EscalationStep)
+	for _, policy := range config.EscalationPolicies {
+		steps := make([]EscalationStep, len(policy.Steps))
+		for i, step := range policy.Steps {
+			// Durations are checked by utils.ValidateConfiguration.
+			after, _ := time.ParseDuration(step.After)
+			repeat, _ := time.ParseDuration(step.Repeat)
+			steps[i] = EscalationStep{After: after, Repeat: repeat, Notifiers: step.Notifiers}
+		}
+		policies[policy.Name] = steps
+	}
+	return &Escalator{policies: policies, active: make(map[string]*escalationState)}
+}
+
+// Start tracks the outage identified by key and returns the notifiers of escalation
+// steps that are due immediately, so they go out with the first notification.
+// Outages without a policy are tracked too so they can be listed and acknowledged.
+func (e *Escalator) Start(key string, policy string, event notifiers.Event, now time.Time) []string {
+	steps := e.policies[policy]
+	state := &escalationState{event: event, steps: steps, next: make([]time.Time, len(steps))}
+	for i, step := range steps {
+		if step.After > 0 {
+			state.next[i] = now.Add(step.After)
+			continue
+		}
+		state.notified = MergeNames(state.notified, step.Notifiers)
+		if step.Repeat > 0 {
+			state.next[i] = now.Add(step.Repeat)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active[key] = state
+	return state.notified
+}
+
+// Due returns the escalations whose time has come and schedules their repeats.
+// Outages for which held returns true are skipped without advancing, so their
+// escalation picks up where it left off once they are no longer held.
+func (e *Escalator) Due(now time.Time, held func(key string, event notifiers.Event) bool) []Escalation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var due []Escalation
+	for key, state := range e.active {
+		if held(key, state.event) {
+			continue
+		}
+		for i, step := range state.steps {
+			if state.next[i].IsZero() || now.Before(state.next[i]) {
+				continue
+			}
+			if step.Repeat > 0 {
+				state.next[i] = now.Add(step.Repeat)
+			} else {
+				state.next[i] = time.Time{}
+			}
+			state.notified = MergeNames(state.notified, step.Notifiers)
+
+			event := state.event
+			event.Title = EscalationTitle
+			event.Timestamp = now
+			event.Escalation = i + 1
+			due = append(due, Escalation{Key: key, Step: i + 1, Notifiers: step.Notifiers, Event: event})
+		}
+	}
+	return due
+}
+
+func (e *Escalator) Active() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0, len(e.active))
+	for key, state := range e.active {
+		alerts = append(alerts, Alert{Key: key, Event: state.event, Notified: append([]string(nil), state.notified...)})
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key < alerts[j].Key })
+	return alerts
+}
+
+// Notified returns the notifiers escalation has reached for key so far.
+func (e *Escalator) Notified(key string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state, ok := e.active[key]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), state.notified...)
+}
+
+// Stop ends the escalation of key and returns every notifier it reached, so the
+// recovery can be sent to them.
+func (e *Escalator) Stop(key string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state, ok := e.active[key]
+	if !ok {
+		return nil
+	}
+	delete(e.active, key)
+	return state.notified
+}
@@ -0,0 +1,97 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+)
+
+type TestResult struct {
+	Notifier string
+	Type     string
+	Kind     string
+	State    string
+	Skipped  bool
+	Err      error
+}
+
+// SampleEvents returns one event of every kind a notifier is normally sent, for
+// checking a notifier's configuration without waiting for a real outage. The
+// outage is followed by its recovery so incident APIs resolve what they opened.
+func SampleEvents() []notifiers.Event {
+	now := time.Now()
+	target := notifiers.InstanceStatus{
+		Address:      "192.0.2.1",
+		Service:      "inframon-notify-test",
+		NetworkZone:  "TEST",
+		InstanceType: "Test",
+		Protocol:     "ICMP",
+		Severity:     DefaultSeverity,
+	}
+	recovered := target
+	recovered.Status = true
+	return []notifiers.Event{
+		{
+			Kind:        notifiers.EventKindTransition,
+			Title:       "Connection Interrupted",
+			Description: "Inframon Notification Test",
+			State:       notifiers.StateDown,
+			Target:      target,
+			Error:       "this is a test notification, no target is down",
+			Timestamp:   now,
+			Since:       now,
+		},
+		{
+			Kind:        notifiers.EventKindTransition,
+			Title:       "Connection Established",
+			Description: "Inframon Notification Test",
+			State:       notifiers.StateUp,
+			Target:      recovered,
+			Timestamp:   now,
+			Since:       now,
+		},
+		{
+			Kind:        notifiers.EventKindSystem,
+			Title:       "Notification Test",
+			Description: "This is a test notification from inframon",
+			Timestamp:   now,
+		},
+		{
+			Kind:      notifiers.EventKindSummary,
+			Title:     "Scheduled Report",
+			Timestamp: now,
+			Statuses:  []notifiers.InstanceStatus{target},
+		},
+	}
+}
+
+// TestNotifiers sends the sample events through the named notifiers, or through
+// all of them when names is empty, and reports the outcome of every send.
+func TestNotifiers(built map[string]notifiers.Notifier, names []string) ([]TestResult, error) {
+	if len(names) == 0 {
+		for name := range built {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var results []TestResult
+	for _, name := range names {
+		notifier, ok := built[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or disabled notifier %s", name)
+		}
+		for _, event := range SampleEvents() {
+			err := notifier.Send(event)
+			result := TestResult{Notifier: name, Type: notifier.Type(), Kind: event.Kind, State: event.State, Err: err}
+			if errors.Is(err, notifiers.ErrEventNotSupported) {
+				result.Skipped = true
+				result.Err = nil
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
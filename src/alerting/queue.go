@@ -0,0 +1,360 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+const (
+	QueueDirectory          = "queue"
+	DeadLetterFile          = "dead-letter.jsonl"
+	DefaultQueueMaxAttempts = 10
+	queueInitialBackoff     = 5 * time.Second
+	queueMaxBackoff         = 5 * time.Minute
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Seq         int64           `json:"seq"`
+	Notifier    string          `json:"notifier"`
+	Event       notifiers.Event `json:"event"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	NextAttempt time.Time       `json:"nextAttempt,omitempty"`
+}
+
+type deadLetter struct {
+	Job
+	DroppedAt time.Time `json:"droppedAt"`
+	Reason    string    `json:"reason"`
+}
+
+type QueueStats struct {
+	Pending   int `json:"pending"`
+	Delivered int `json:"delivered"`
+	Retried   int `json:"retried"`
+	Dropped   int `json:"dropped"`
+}
+
+// Queue delivers notifications asynchronously with one worker per notifier, so
+// a slow or failing destination neither blocks probes nor other notifiers. Jobs
+// are retried with exponential backoff, honouring Retry-After, and moved to a
+// dead-letter file once they run out of attempts. With a state directory every
+// pending job is kept on disk and resumed after a restart.
+type Queue struct {
+	mu          sync.Mutex
+	dir         string
+	deadLetter  string
+	maxAttempts int
+	send        func(name string, event notifiers.Event) error
+	backoff     func(attempts int) time.Duration
+	logger      *utils.SafeLogger
+	seq         int64
+	jobs        map[string][]*Job
+	wake        map[string]chan struct{}
+	stats       map[string]*QueueStats
+	idle        *sync.Cond
+	busy        map[string]bool
+}
+
+func NewQueue(stateDirectory string, maxAttempts int, logger *utils.SafeLogger, send func(name string, event notifiers.Event) error) (*Queue, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultQueueMaxAttempts
+	}
+	q := &Queue{
+		maxAttempts: maxAttempts,
+		send:        send,
+		backoff:     backoff,
+		logger:      logger,
+		seq:         time.Now().UnixNano(),
+		jobs:        make(map[string][]*Job),
+		wake:        make(map[string]chan struct{}),
+		stats:       make(map[string]*QueueStats),
+		busy:        make(map[string]bool),
+	}
+	q.idle = sync.NewCond(&q.mu)
+	if stateDirectory == "" {
+		return q, nil
+	}
+	q.dir = filepath.Join(stateDirectory, QueueDirectory)
+	q.deadLetter = filepath.Join(stateDirectory, DeadLetterFile)
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	return q, nil
+}
+
+// Resume loads the jobs left on disk by a previous run. Jobs for notifiers that
+// no longer exist are dead-lettered.
+func (q *Queue) Resume(known map[string]notifiers.Notifier) (int, error) {
+	if q.dir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+	var jobs []*Job
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, entry.Name()))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read queued job %s: %w", entry.Name(), err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return 0, fmt.Errorf("failed to parse queued job %s: %w", entry.Name(), err)
+		}
+		jobs = append(jobs, &job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Seq < jobs[j].Seq })
+
+	for _, job := range jobs {
+		if _, ok := known[job.Notifier]; !ok {
+			q.drop(job, "notifier no longer configured")
+			continue
+		}
+		q.push(job)
+	}
+	return len(jobs), nil
+}
+
+func (q *Queue) Enqueue(name string, event notifiers.Event) error {
+	if coalesced, err := q.coalesce(name, event); coalesced {
+		return err
+	}
+	q.mu.Lock()
+	q.seq++
+	job := &Job{ID: newID(), Seq: q.seq, Notifier: name, Event: event, CreatedAt: time.Now()}
+	q.mu.Unlock()
+	if err := q.persist(job); err != nil {
+		return err
+	}
+	q.push(job)
+	return nil
+}
+
+// coalesce replaces the event of a refresh that is still waiting for the same
+// target with a newer one, so refreshes do not pile up while the destination is
+// unreachable. It only looks at the last job of the target, so the order of its
+// transitions is kept.
+func (q *Queue) coalesce(name string, event notifiers.Event) (bool, error) {
+	if event.Kind != notifiers.EventKindRefresh {
+		return false, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := q.jobs[name]
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if jobs[i].Event.Target.ID != event.Target.ID {
+			continue
+		}
+		// The first job is being sent while the worker is busy.
+		if jobs[i].Event.Kind != notifiers.EventKindRefresh || (i == 0 && q.busy[name]) {
+			return false, nil
+		}
+		jobs[i].Event = event
+		return true, q.persist(jobs[i])
+	}
+	return false, nil
+}
+
+func (q *Queue) push(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[job.Notifier] = append(q.jobs[job.Notifier], job)
+	q.statsFor(job.Notifier).Pending++
+	wake, ok := q.wake[job.Notifier]
+	if !ok {
+		wake = make(chan struct{}, 1)
+		q.wake[job.Notifier] = wake
+		go q.work(job.Notifier, wake)
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// work delivers the jobs of one notifier in order. A job that keeps failing
+// holds back the ones behind it, so a recovery never overtakes its outage.
+func (q *Queue) work(name string, wake chan struct{}) {
+	for {
+		q.mu.Lock()
+		if len(q.jobs[name]) == 0 {
+			q.busy[name] = false
+			q.idle.Broadcast()
+			q.mu.Unlock()
+			<-wake
+			continue
+		}
+		q.busy[name] = true
+		job := q.jobs[name][0]
+		q.mu.Unlock()
+
+		if wait := time.Until(job.NextAttempt); wait > 0 {
+			time.Sleep(wait)
+		}
+		err := q.send(name, job.Event)
+		if err == nil {
+			q.finish(job)
+			q.mu.Lock()
+			q.statsFor(name).Delivered++
+			q.mu.Unlock()
+			continue
+		}
+
+		job.Attempts++
+		job.LastError = err.Error()
+		if job.Attempts >= q.maxAttempts {
+			q.finish(job)
+			q.drop(job, fmt.Sprintf("gave up after %d attempts: %s", job.Attempts, err))
+			continue
+		}
+		delay := notifiers.RetryDelay(err, q.backoff(job.Attempts))
+		job.NextAttempt = time.Now().Add(delay)
+		if err := q.persist(job); err != nil {
+			utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Unable to persist job [%s] for [%s] :: [%s]", job.ID, name, err), "ERROR")
+		}
+		q.mu.Lock()
+		q.statsFor(name).Retried++
+		q.mu.Unlock()
+		utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Retrying %s notification to [%s] in %v (attempt %d of %d)", job.Event.Kind, name, delay, job.Attempts+1, q.maxAttempts), "INFO")
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := queueInitialBackoff
+	for i := 1; i < attempts && delay < queueMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > queueMaxBackoff {
+		delay = queueMaxBackoff
+	}
+	return delay
+}
+
+// finish removes the job at the head of its notifier's queue.
+func (q *Queue) finish(job *Job) {
+	q.mu.Lock()
+	q.jobs[job.Notifier] = q.jobs[job.Notifier][1:]
+	q.statsFor(job.Notifier).Pending--
+	q.mu.Unlock()
+	if q.dir != "" {
+		if err := os.Remove(q.jobPath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Unable to remove job [%s] :: [%s]", job.ID, err), "ERROR")
+		}
+	}
+}
+
+func (q *Queue) drop(job *Job, reason string) {
+	q.mu.Lock()
+	q.statsFor(job.Notifier).Dropped++
+	q.mu.Unlock()
+	utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Dropped %s notification to [%s] :: [%s]", job.Event.Kind, job.Notifier, reason), "ERROR")
+	if q.dir == "" {
+		return
+	}
+	if err := q.appendDeadLetter(deadLetter{Job: *job, DroppedAt: time.Now(), Reason: reason}); err != nil {
+		utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Unable to write dead letter for job [%s] :: [%s]", job.ID, err), "ERROR")
+	}
+	if err := os.Remove(q.jobPath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		utils.ConsoleAndLoggerOutput(q.logger, "QUEUE", fmt.Sprintf("Unable to remove job [%s] :: [%s]", job.ID, err), "ERROR")
+	}
+}
+
+func (q *Queue) appendDeadLetter(entry deadLetter) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(q.deadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func (q *Queue) persist(job *Job) error {
+	if q.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	path := q.jobPath(job)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (q *Queue) jobPath(job *Job) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%d-%s.json", job.Seq, job.ID))
+}
+
+// statsFor returns the counters of a notifier. Callers hold q.mu.
+func (q *Queue) statsFor(name string) *QueueStats {
+	stats, ok := q.stats[name]
+	if !ok {
+		stats = &QueueStats{}
+		q.stats[name] = stats
+	}
+	return stats
+}
+
+func (q *Queue) Stats() map[string]QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := make(map[string]QueueStats, len(q.stats))
+	for name, s := range q.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// Drain waits until every queue is empty or timeout passes, and reports whether
+// everything was delivered.
+func (q *Queue) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for q.pending() {
+			q.idle.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// pending reports whether any job is queued or in flight. Callers hold q.mu.
+func (q *Queue) pending() bool {
+	for name, jobs := range q.jobs {
+		if len(jobs) > 0 || q.busy[name] {
+			return true
+		}
+	}
+	return false
+}
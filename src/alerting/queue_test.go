@@ -0,0 +1,318 @@
+package alerting
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+// recorder is the send function of a test queue. It fails the first failures[n]
+// attempts of the event titled n and records every event it delivers.
+type recorder struct {
+	mu        sync.Mutex
+	failures  map[string]int
+	attempts  map[string]int
+	delivered []string
+	gate      chan struct{}
+}
+
+func newRecorder(failures map[string]int) *recorder {
+	return &recorder{failures: failures, attempts: make(map[string]int)}
+}
+
+func (r *recorder) send(name string, event notifiers.Event) error {
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[event.Title]++
+	if r.attempts[event.Title] <= r.failures[event.Title] {
+		return errors.New("unreachable")
+	}
+	r.delivered = append(r.delivered, event.Title)
+	return nil
+}
+
+func (r *recorder) result() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.delivered...)
+}
+
+func newTestQueue(t *testing.T, dir string, maxAttempts int, send func(string, notifiers.Event) error) *Queue {
+	t.Helper()
+	logger, err := utils.SetupLogger(true, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(dir, maxAttempts, logger, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff = func(int) time.Duration { return time.Millisecond }
+	return q
+}
+
+func transition(title string, target string) notifiers.Event {
+	return notifiers.Event{Kind: notifiers.EventKindTransition, Title: title, Target: notifiers.InstanceStatus{ID: target}}
+}
+
+func refresh(title string, target string) notifiers.Event {
+	return notifiers.Event{Kind: notifiers.EventKindRefresh, Title: title, Target: notifiers.InstanceStatus{ID: target}}
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{6, 160 * time.Second},
+		{7, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestQueueDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []string
+		failures    map[string]int
+		maxAttempts int
+		delivered   []string
+		stats       QueueStats
+	}{
+		{
+			name:      "in order",
+			events:    []string{"down", "up", "down again"},
+			delivered: []string{"down", "up", "down again"},
+			stats:     QueueStats{Delivered: 3},
+		},
+		{
+			name:        "a failing job holds back the ones behind it",
+			events:      []string{"down", "up"},
+			failures:    map[string]int{"down": 2},
+			maxAttempts: 5,
+			delivered:   []string{"down", "up"},
+			stats:       QueueStats{Delivered: 2, Retried: 2},
+		},
+		{
+			name:        "a job that runs out of attempts is dropped",
+			events:      []string{"down", "up"},
+			failures:    map[string]int{"down": 3},
+			maxAttempts: 3,
+			delivered:   []string{"up"},
+			stats:       QueueStats{Delivered: 1, Retried: 2, Dropped: 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRecorder(test.failures)
+			q := newTestQueue(t, "", test.maxAttempts, r.send)
+			for _, title := range test.events {
+				if err := q.Enqueue("hook", transition(title, "gw")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !q.Drain(5 * time.Second) {
+				t.Fatal("queue did not drain")
+			}
+			if got := r.result(); !equal(got, test.delivered) {
+				t.Errorf("delivered %v, want %v", got, test.delivered)
+			}
+			if got := q.Stats()["hook"]; got != test.stats {
+				t.Errorf("stats %+v, want %+v", got, test.stats)
+			}
+		})
+	}
+}
+
+func TestQueueCoalescesRefreshes(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    []notifiers.Event
+		delivered []string
+	}{
+		{
+			name:      "a newer refresh replaces a waiting one",
+			events:    []notifiers.Event{refresh("refresh 1", "gw"), refresh("refresh 2", "gw")},
+			delivered: []string{"head", "refresh 2"},
+		},
+		{
+			name:      "refreshes of other targets are kept",
+			events:    []notifiers.Event{refresh("refresh gw", "gw"), refresh("refresh db", "db")},
+			delivered: []string{"head", "refresh gw", "refresh db"},
+		},
+		{
+			name:      "a refresh never overtakes a transition",
+			events:    []notifiers.Event{refresh("refresh 1", "gw"), transition("up", "gw"), refresh("refresh 2", "gw")},
+			delivered: []string{"head", "refresh 1", "up", "refresh 2"},
+		},
+		{
+			name:      "transitions are never coalesced",
+			events:    []notifiers.Event{transition("down", "gw"), transition("up", "gw")},
+			delivered: []string{"head", "down", "up"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRecorder(nil)
+			r.gate = make(chan struct{})
+			q := newTestQueue(t, "", 0, r.send)
+			// The head job stays in flight until the gate opens, so the events
+			// after it wait in the queue.
+			if err := q.Enqueue("alertmanager", refresh("head", "gw")); err != nil {
+				t.Fatal(err)
+			}
+			waitBusy(t, q, "alertmanager")
+			for _, event := range test.events {
+				if err := q.Enqueue("alertmanager", event); err != nil {
+					t.Fatal(err)
+				}
+			}
+			close(r.gate)
+			if !q.Drain(5 * time.Second) {
+				t.Fatal("queue did not drain")
+			}
+			if got := r.result(); !equal(got, test.delivered) {
+				t.Errorf("delivered %v, want %v", got, test.delivered)
+			}
+		})
+	}
+}
+
+func waitBusy(t *testing.T, q *Queue, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		q.mu.Lock()
+		busy := q.busy[name]
+		q.mu.Unlock()
+		if busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("worker of %s never started", name)
+}
+
+func TestQueueResume(t *testing.T) {
+	dir := t.TempDir()
+	blocked := newRecorder(nil)
+	// The gate is never opened, so the first queue keeps every job on disk.
+	blocked.gate = make(chan struct{})
+	first := newTestQueue(t, dir, 0, blocked.send)
+	for _, job := range []struct{ notifier, title string }{
+		{"hook", "down"},
+		{"hook", "up"},
+		{"removed", "lost"},
+		{"hook", "down again"},
+	} {
+		if err := first.Enqueue(job.notifier, transition(job.title, "gw")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A second queue on the same directory stands in for the next run.
+	r := newRecorder(nil)
+	second := newTestQueue(t, dir, 0, r.send)
+	resumed, err := second.Resume(map[string]notifiers.Notifier{"hook": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != 4 {
+		t.Errorf("resumed %d jobs, want 4", resumed)
+	}
+	if !second.Drain(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+	want := []string{"down", "up", "down again"}
+	if got := r.result(); !equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if stats := second.Stats()["removed"]; stats.Dropped != 1 {
+		t.Errorf("dropped %d jobs of a removed notifier, want 1", stats.Dropped)
+	}
+
+	letters := readDeadLetters(t, filepath.Join(dir, DeadLetterFile))
+	if len(letters) != 1 || letters[0].Notifier != "removed" || letters[0].Reason != "notifier no longer configured" {
+		t.Errorf("dead letters %+v, want the job of the removed notifier", letters)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, QueueDirectory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d job files left after delivery, want none", len(entries))
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	r := newRecorder(map[string]int{"down": 10})
+	q := newTestQueue(t, dir, 2, r.send)
+	if err := q.Enqueue("hook", transition("down", "gw")); err != nil {
+		t.Fatal(err)
+	}
+	if !q.Drain(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+	letters := readDeadLetters(t, filepath.Join(dir, DeadLetterFile))
+	if len(letters) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.Event.Title != "down" || letter.Attempts != 2 || letter.LastError != "unreachable" {
+		t.Errorf("dead letter %+v, want the down event after 2 attempts", letter)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, QueueDirectory)); len(entries) != 0 {
+		t.Errorf("%d job files left after dropping, want none", len(entries))
+	}
+}
+
+func readDeadLetters(t *testing.T, path string) []deadLetter {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []deadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
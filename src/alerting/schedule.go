@@ -0,0 +1,211 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	// The container image ships without a zoneinfo database.
+	_ "time/tzdata"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+const HeldFile = "held.json"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type scheduleWindow struct {
+	days  map[time.Weekday]bool
+	start int
+	end   int
+}
+
+// Schedule is a notifier's delivery window. Transitions of targets whose severity
+// is not immediate are held while it is closed.
+type Schedule struct {
+	location  *time.Location
+	windows   []scheduleWindow
+	immediate []string
+}
+
+func NewSchedule(config utils.ScheduleConfig) (*Schedule, error) {
+	location := time.Local
+	if config.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %s: %w", config.Timezone, err)
+		}
+	}
+	schedule := &Schedule{location: location, immediate: config.ImmediateSeverities}
+	if len(schedule.immediate) == 0 {
+		schedule.immediate = []string{DefaultSeverity}
+	}
+	for _, w := range config.Windows {
+		window := scheduleWindow{days: make(map[time.Weekday]bool)}
+		for _, day := range w.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %s", day)
+			}
+			window.days[weekday] = true
+		}
+		var err error
+		if window.start, err = parseClock(w.Start); err != nil {
+			return nil, fmt.Errorf("invalid start %s: %w", w.Start, err)
+		}
+		if window.end, err = parseClock(w.End); err != nil {
+			return nil, fmt.Errorf("invalid end %s: %w", w.End, err)
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return schedule, nil
+}
+
+// parseClock returns the minutes since midnight of a HH:MM time. 24:00 is allowed
+// as the end of a day.
+func parseClock(value string) (int, error) {
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Open reports whether now falls in one of the windows. A window whose end is
+// before its start runs past midnight and belongs to the day it starts on.
+func (s *Schedule) Open(now time.Time) bool {
+	now = now.In(s.location)
+	minute := now.Hour()*60 + now.Minute()
+	yesterday := now.AddDate(0, 0, -1).Weekday()
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.onDay(now.Weekday()) && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		if w.onDay(now.Weekday()) && minute >= w.start {
+			return true
+		}
+		if w.onDay(yesterday) && minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (w scheduleWindow) onDay(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+func (s *Schedule) Immediate(severity string) bool {
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	return contains(s.immediate, severity)
+}
+
+// Schedules holds back transitions for notifiers outside their delivery window and
+// releases them once the window opens. Held transitions are kept in held.json
+// inside the state directory so they survive a restart.
+type Schedules struct {
+	mu        sync.Mutex
+	path      string
+	schedules map[string]*Schedule
+	held      map[string][]notifiers.Event
+}
+
+func LoadSchedules(config *utils.Config, stateDirectory string) (*Schedules, error) {
+	s := &Schedules{schedules: make(map[string]*Schedule), held: make(map[string][]notifiers.Event)}
+	for _, n := range config.Notifiers {
+		if n.Schedule == nil {
+			continue
+		}
+		schedule, err := NewSchedule(*n.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", n.Name, err)
+		}
+		s.schedules[n.Name] = schedule
+	}
+	if stateDirectory == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(stateDirectory, HeldFile)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	if err := json.Unmarshal(data, &s.held); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// Hold keeps event for later if name is outside its delivery window and the event
+// is a transition of a target whose severity is not immediate.
+func (s *Schedules) Hold(name string, event notifiers.Event, now time.Time) (bool, error) {
+	schedule, ok := s.schedules[name]
+	if !ok || event.Kind != notifiers.EventKindTransition || schedule.Immediate(event.Target.Severity) || schedule.Open(now) {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held[name] = append(s.held[name], event)
+	return true, s.save()
+}
+
+// Due returns and forgets the held transitions of every notifier whose window is
+// open at now.
+func (s *Schedules) Due(now time.Time) (map[string][]notifiers.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := make(map[string][]notifiers.Event)
+	for name, events := range s.held {
+		schedule, ok := s.schedules[name]
+		if ok && !schedule.Open(now) {
+			continue
+		}
+		due[name] = events
+		delete(s.held, name)
+	}
+	if len(due) == 0 {
+		return due, nil
+	}
+	return due, s.save()
+}
+
+func (s *Schedules) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.held, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal held notifications: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,204 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+func window(days []string, start string, end string) utils.ScheduleWindowConfig {
+	return utils.ScheduleWindowConfig{Days: days, Start: start, End: end}
+}
+
+// at is a time on the week of Monday 2026-10-19 in location.
+func at(t *testing.T, location string, day int, clock string) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Date(2026, time.October, 19+day, parsed.Hour(), parsed.Minute(), 0, 0, loc)
+}
+
+func TestScheduleOpen(t *testing.T) {
+	const (
+		mon = 0
+		tue = 1
+		sat = 5
+		sun = 6
+	)
+	tests := []struct {
+		name     string
+		timezone string
+		windows  []utils.ScheduleWindowConfig
+		zone     string
+		day      int
+		clock    string
+		want     bool
+	}{
+		{"overnight window before midnight", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "22:00", "06:00")}, "UTC", mon, "23:00", true},
+		{"overnight window after midnight belongs to the day it starts", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "22:00", "06:00")}, "UTC", tue, "05:59", true},
+		{"overnight window ends at its end", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "22:00", "06:00")}, "UTC", tue, "06:00", false},
+		{"overnight window of the day before is not configured", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "22:00", "06:00")}, "UTC", mon, "05:00", false},
+		{"overnight window does not start on other days", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "22:00", "06:00")}, "UTC", tue, "23:00", false},
+		{"window until 24:00 includes the last minute", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "18:00", "24:00")}, "UTC", mon, "23:59", true},
+		{"window until 24:00 closes at midnight", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "18:00", "24:00")}, "UTC", tue, "00:00", false},
+		{"window until 24:00 opens at its start", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "18:00", "24:00")}, "UTC", mon, "17:59", false},
+		{"whole day opens at midnight", "UTC", []utils.ScheduleWindowConfig{window([]string{"sat"}, "00:00", "24:00")}, "UTC", sat, "00:00", true},
+		{"whole day closes with the day", "UTC", []utils.ScheduleWindowConfig{window([]string{"sat"}, "00:00", "24:00")}, "UTC", sun, "00:00", false},
+		{"window without days is open every day", "UTC", []utils.ScheduleWindowConfig{window(nil, "08:00", "20:00")}, "UTC", sun, "12:00", true},
+		{"any of several windows", "UTC", []utils.ScheduleWindowConfig{window([]string{"mon"}, "08:00", "10:00"), window([]string{"sun"}, "10:00", "12:00")}, "UTC", sun, "11:00", true},
+		{"timezone is applied to the time", "America/New_York", []utils.ScheduleWindowConfig{window([]string{"mon"}, "09:00", "17:00")}, "UTC", mon, "13:30", true},
+		{"timezone before the window", "America/New_York", []utils.ScheduleWindowConfig{window([]string{"mon"}, "09:00", "17:00")}, "UTC", mon, "12:30", false},
+		{"timezone after the window", "America/New_York", []utils.ScheduleWindowConfig{window([]string{"mon"}, "09:00", "17:00")}, "UTC", mon, "21:30", false},
+		{"timezone decides the day", "America/New_York", []utils.ScheduleWindowConfig{window([]string{"mon"}, "20:00", "23:00")}, "UTC", tue, "02:00", true},
+		{"timezone with daylight saving time", "Europe/Berlin", []utils.ScheduleWindowConfig{window([]string{"mon"}, "09:00", "17:00")}, "UTC", mon, "07:00", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := NewSchedule(utils.ScheduleConfig{Timezone: test.timezone, Windows: test.windows})
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := at(t, test.zone, test.day, test.clock)
+			if got := schedule.Open(now); got != test.want {
+				t.Errorf("Open(%s) = %v, want %v", now.Format(time.RFC1123), got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config utils.ScheduleConfig
+	}{
+		{"unknown timezone", utils.ScheduleConfig{Timezone: "Mars/Olympus"}},
+		{"unknown day", utils.ScheduleConfig{Windows: []utils.ScheduleWindowConfig{window([]string{"someday"}, "08:00", "10:00")}}},
+		{"bad start", utils.ScheduleConfig{Windows: []utils.ScheduleWindowConfig{window(nil, "8h", "10:00")}}},
+		{"end after the end of the day", utils.ScheduleConfig{Windows: []utils.ScheduleWindowConfig{window(nil, "08:00", "24:30")}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewSchedule(test.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSchedulesHeldRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	config := &utils.Config{Notifiers: []utils.NotifierConfig{{
+		Name: "mail",
+		Type: "smtp",
+		Schedule: &utils.ScheduleConfig{
+			Timezone: "UTC",
+			Windows:  []utils.ScheduleWindowConfig{window([]string{"mon", "tue"}, "09:00", "17:00")},
+		},
+	}}}
+	closed := at(t, "UTC", 0, "20:00")
+	down := notifiers.Event{
+		Kind:      notifiers.EventKindTransition,
+		Title:     "Connection Interrupted",
+		State:     notifiers.StateDown,
+		Target:    notifiers.InstanceStatus{ID: "nas", Address: "10.0.0.5", Severity: "warning"},
+		Timestamp: closed,
+	}
+
+	schedules, err := LoadSchedules(config, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holds := []struct {
+		name  string
+		event notifiers.Event
+		want  bool
+	}{
+		{"transition of a warning target", down, true},
+		{"transition of a critical target", notifiers.Event{Kind: notifiers.EventKindTransition, Target: notifiers.InstanceStatus{ID: "gw", Severity: "critical"}}, false},
+		{"system event", notifiers.Event{Kind: notifiers.EventKindSystem, Title: "Inframon Started"}, false},
+	}
+	for _, hold := range holds {
+		held, err := schedules.Hold("mail", hold.event, closed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != hold.want {
+			t.Errorf("%s: held = %v, want %v", hold.name, held, hold.want)
+		}
+	}
+	if held, _ := schedules.Hold("discord", down, closed); held {
+		t.Error("held an event for a notifier without a schedule")
+	}
+
+	// Held transitions survive a restart and are released once the window opens.
+	reloaded, err := LoadSchedules(config, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := reloaded.Due(closed.Add(30 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("released %v while the window is closed", due)
+	}
+	due, err = reloaded.Due(at(t, "UTC", 1, "09:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := due["mail"]
+	if len(events) != 1 {
+		t.Fatalf("released %d events, want 1", len(events))
+	}
+	got := events[0]
+	if got.Title != down.Title || got.State != down.State || got.Target.ID != down.Target.ID || !got.Timestamp.Equal(down.Timestamp) {
+		t.Errorf("released %+v, want %+v", got, down)
+	}
+
+	// Released transitions are forgotten on disk too.
+	again, err := LoadSchedules(config, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := again.Due(at(t, "UTC", 1, "10:00")); len(due) != 0 {
+		t.Errorf("released %v twice", due)
+	}
+}
+
+func TestSchedulesReleaseHeldOfUnscheduledNotifier(t *testing.T) {
+	dir := t.TempDir()
+	scheduled := &utils.Config{Notifiers: []utils.NotifierConfig{{
+		Name:     "mail",
+		Type:     "smtp",
+		Schedule: &utils.ScheduleConfig{Timezone: "UTC", Windows: []utils.ScheduleWindowConfig{window([]string{"mon"}, "09:00", "10:00")}},
+	}}}
+	schedules, err := LoadSchedules(scheduled, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := notifiers.Event{Kind: notifiers.EventKindTransition, Target: notifiers.InstanceStatus{ID: "nas", Severity: "info"}}
+	if held, err := schedules.Hold("mail", event, at(t, "UTC", 0, "12:00")); err != nil || !held {
+		t.Fatalf("held = %v, %v", held, err)
+	}
+
+	// Without its schedule the notifier has nothing to wait for.
+	unscheduled, err := LoadSchedules(&utils.Config{Notifiers: []utils.NotifierConfig{{Name: "mail", Type: "smtp"}}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := unscheduled.Due(at(t, "UTC", 0, "12:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due["mail"]) != 1 {
+		t.Errorf("released %v, want the held transition", due)
+	}
+}
@@ -0,0 +1,333 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/notifiers"
+	"github.com/somememoryspace/inframon/src/utils"
+)
+
+const SilencesFile = "silences.json"
+
+var ErrNotFound = errors.New("not found")
+
+type Matcher struct {
+	ID           string            `json:"id,omitempty"`
+	Address      string            `json:"address,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	NetworkZone  string            `json:"networkZone,omitempty"`
+	InstanceType string            `json:"instanceType,omitempty"`
+	Protocol     string            `json:"protocol,omitempty"`
+	Severity     string            `json:"severity,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+func (m Matcher) Empty() bool {
+	return m.ID == "" && m.Address == "" && m.Service == "" && m.NetworkZone == "" && m.InstanceType == "" && m.Protocol == "" && m.Severity == "" && len(m.Tags) == 0 && len(m.Labels) == 0
+}
+
+// Matches reports whether every field set in m equals the target's value. Tags
+// match when the target has all of them, and labels when the target has each
+// with the same value.
+func (m Matcher) Matches(target notifiers.InstanceStatus) bool {
+	if m.ID != "" && m.ID != target.ID {
+		return false
+	}
+	if m.Address != "" && m.Address != target.Address {
+		return false
+	}
+	if m.Service != "" && m.Service != target.Service {
+		return false
+	}
+	if m.NetworkZone != "" && m.NetworkZone != target.NetworkZone {
+		return false
+	}
+	if m.InstanceType != "" && m.InstanceType != target.InstanceType {
+		return false
+	}
+	if m.Protocol != "" && m.Protocol != target.Protocol {
+		return false
+	}
+	severity := target.Severity
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	if m.Severity != "" && m.Severity != severity {
+		return false
+	}
+	for _, tag := range m.Tags {
+		if !contains(target.Tags, tag) {
+			return false
+		}
+	}
+	for name, value := range m.Labels {
+		if target.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+type Silence struct {
+	ID        string    `json:"id"`
+	Matcher   Matcher   `json:"matcher"`
+	Author    string    `json:"author"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+type Acknowledgement struct {
+	ID        string                   `json:"id"`
+	Key       string                   `json:"key"`
+	Target    notifiers.InstanceStatus `json:"target"`
+	Author    string                   `json:"author"`
+	Comment   string                   `json:"comment,omitempty"`
+	CreatedAt time.Time                `json:"createdAt"`
+	ExpiresAt time.Time                `json:"expiresAt,omitempty"`
+}
+
+func (a Acknowledgement) Notification() *notifiers.Acknowledgement {
+	return &notifiers.Acknowledgement{Author: a.Author, Comment: a.Comment, Time: a.CreatedAt}
+}
+
+// Silences holds silences and acknowledgements. When it has a path, every change
+// is written to it so both survive a restart.
+type Silences struct {
+	mu               sync.Mutex
+	path             string
+	silences         []Silence
+	acknowledgements []Acknowledgement
+}
+
+type silencesFile struct {
+	Silences         []Silence         `json:"silences"`
+	Acknowledgements []Acknowledgement `json:"acknowledgements"`
+}
+
+func LoadSilences(stateDirectory string) (*Silences, error) {
+	s := &Silences{}
+	if stateDirectory == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(stateDirectory, SilencesFile)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	var file silencesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	s.silences = file.Silences
+	s.acknowledgements = file.Acknowledgements
+	return s, nil
+}
+
+// MigrateAcknowledgements rewrites acknowledgements keyed by AddressKey, as they
+// were saved before targets had ids, to the id of their target. An address that
+// is now monitored more than once goes to its target without an id of its own,
+// which is the one that was acknowledged.
+func (s *Silences) MigrateAcknowledgements(targets []notifiers.InstanceStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[string]string)
+	for _, target := range targets {
+		key := notifiers.AddressKey(target)
+		if _, ok := ids[key]; ok && target.ID != utils.TargetID(target.Protocol, target.Address) {
+			continue
+		}
+		ids[key] = target.ID
+	}
+	migrated := false
+	for i, ack := range s.acknowledgements {
+		if id, ok := ids[ack.Key]; ok {
+			s.acknowledgements[i].Key = id
+			s.acknowledgements[i].Target.ID = id
+			migrated = true
+		}
+	}
+	if !migrated {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *Silences) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(silencesFile{Silences: s.silences, Acknowledgements: s.acknowledgements}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// prune drops expired entries. Callers hold s.mu.
+func (s *Silences) prune(now time.Time) {
+	silences := s.silences[:0]
+	for _, silence := range s.silences {
+		if now.Before(silence.EndsAt) {
+			silences = append(silences, silence)
+		}
+	}
+	s.silences = silences
+	acknowledgements := s.acknowledgements[:0]
+	for _, ack := range s.acknowledgements {
+		if ack.ExpiresAt.IsZero() || now.Before(ack.ExpiresAt) {
+			acknowledgements = append(acknowledgements, ack)
+		}
+	}
+	s.acknowledgements = acknowledgements
+}
+
+func (s *Silences) AddSilence(silence Silence) (Silence, error) {
+	if silence.Matcher.Empty() {
+		return Silence{}, fmt.Errorf("silence needs at least one matcher")
+	}
+	if silence.Author == "" {
+		return Silence{}, fmt.Errorf("silence needs an author")
+	}
+	now := time.Now()
+	if !silence.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("silence must end in the future")
+	}
+	silence.ID = newID()
+	silence.CreatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	s.silences = append(s.silences, silence)
+	return silence, s.save()
+}
+
+func (s *Silences) ExpireSilence(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, silence := range s.silences {
+		if silence.ID == id {
+			s.silences = append(s.silences[:i], s.silences[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *Silences) ListSilences() []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	return append([]Silence(nil), s.silences...)
+}
+
+// Silenced returns the first active silence matching target.
+func (s *Silences) Silenced(target notifiers.InstanceStatus, now time.Time) *Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, silence := range s.silences {
+		if now.Before(silence.EndsAt) && silence.Matcher.Matches(target) {
+			return &silence
+		}
+	}
+	return nil
+}
+
+// Acknowledge records an acknowledgement for the outage of key, replacing any
+// earlier one. It lasts until the target recovers or, if set, until expiresAt.
+func (s *Silences) Acknowledge(key string, target notifiers.InstanceStatus, author string, comment string, expiresAt time.Time) (Acknowledgement, error) {
+	if author == "" {
+		return Acknowledgement{}, fmt.Errorf("acknowledgement needs an author")
+	}
+	ack := Acknowledgement{
+		ID:        newID(),
+		Key:       key,
+		Target:    target,
+		Author:    author,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(ack.CreatedAt)
+	s.removeAcknowledgement(key)
+	s.acknowledgements = append(s.acknowledgements, ack)
+	return ack, s.save()
+}
+
+func (s *Silences) Acknowledged(key string, now time.Time) *Acknowledgement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ack := range s.acknowledgements {
+		if ack.Key == key && (ack.ExpiresAt.IsZero() || now.Before(ack.ExpiresAt)) {
+			return &ack
+		}
+	}
+	return nil
+}
+
+func (s *Silences) ListAcknowledgements() []Acknowledgement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	return append([]Acknowledgement(nil), s.acknowledgements...)
+}
+
+func (s *Silences) RemoveAcknowledgement(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ack := range s.acknowledgements {
+		if ack.ID == id {
+			s.removeAcknowledgement(ack.Key)
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// ClearAcknowledgement forgets the acknowledgement of key once its outage is over.
+func (s *Silences) ClearAcknowledgement(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.removeAcknowledgement(key) {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *Silences) removeAcknowledgement(key string) bool {
+	for i, ack := range s.acknowledgements {
+		if ack.Key == key {
+			s.acknowledgements = append(s.acknowledgements[:i], s.acknowledgements[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/alerting"
+	"github.com/somememoryspace/inframon/src/notifiers"
+)
+
+const DefaultListen = "127.0.0.1:8686"
+
+type SilenceRequest struct {
+	Matcher  alerting.Matcher `json:"matcher"`
+	Duration string           `json:"duration,omitempty"`
+	EndsAt   time.Time        `json:"endsAt,omitempty"`
+	Author   string           `json:"author"`
+	Comment  string           `json:"comment,omitempty"`
+}
+
+// AcknowledgeRequest acknowledges the active alert with Key, or every active alert
+// matching Matcher. Key may also be the id of a configured target that is not
+// known to be up, such as one that was down before a restart and has not been
+// probed since. Duration is optional; without it the acknowledgement lasts until
+// the target recovers.
+type AcknowledgeRequest struct {
+	Key      string           `json:"key,omitempty"`
+	Matcher  alerting.Matcher `json:"matcher"`
+	Duration string           `json:"duration,omitempty"`
+	Author   string           `json:"author"`
+	Comment  string           `json:"comment,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Server struct {
+	silences      *alerting.Silences
+	escalator     *alerting.Escalator
+	queue         *alerting.Queue
+	status        func() Status
+	targets       []notifiers.InstanceStatus
+	token         string
+	onAcknowledge func(alerting.Acknowledgement)
+}
+
+func NewServer(silences *alerting.Silences, escalator *alerting.Escalator, queue *alerting.Queue, status func() Status, targets []notifiers.InstanceStatus, token string, onAcknowledge func(alerting.Acknowledgement)) *Server {
+	return &Server{silences: silences, escalator: escalator, queue: queue, status: status, targets: targets, token: token, onAcknowledge: onAcknowledge}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/alerts", s.listAlerts)
+	mux.HandleFunc("GET /api/v1/silences", s.listSilences)
+	mux.HandleFunc("POST /api/v1/silences", s.createSilence)
+	mux.HandleFunc("DELETE /api/v1/silences/{id}", s.expireSilence)
+	mux.HandleFunc("GET /api/v1/acknowledgements", s.listAcknowledgements)
+	mux.HandleFunc("POST /api/v1/acknowledgements", s.acknowledge)
+	mux.HandleFunc("DELETE /api/v1/acknowledgements/{id}", s.removeAcknowledgement)
+	mux.HandleFunc("GET /api/v1/queue", s.queueStats)
+	mux.HandleFunc("GET /api/v1/status", s.showStatus)
+	mux.HandleFunc("GET /api/v1/status/{id}", s.showTarget)
+	return s.authenticate(mux)
+}
+
+func (s *Server) ListenAndServe(address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			expected := []byte("Bearer " + s.token)
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listAlerts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.escalator.Active())
+}
+
+func (s *Server) listSilences(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.silences.ListSilences())
+}
+
+func (s *Server) createSilence(w http.ResponseWriter, r *http.Request) {
+	var request SilenceRequest
+	if err := decode(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	endsAt := request.EndsAt
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", request.Duration))
+			return
+		}
+		endsAt = time.Now().Add(duration)
+	}
+	if endsAt.IsZero() {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("silence needs a duration or endsAt"))
+		return
+	}
+	silence, err := s.silences.AddSilence(alerting.Silence{
+		Matcher: request.Matcher,
+		Author:  request.Author,
+		Comment: request.Comment,
+		EndsAt:  endsAt,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func (s *Server) expireSilence(w http.ResponseWriter, r *http.Request) {
+	if err := s.silences.ExpireSilence(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listAcknowledgements(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.silences.ListAcknowledgements())
+}
+
+func (s *Server) acknowledge(w http.ResponseWriter, r *http.Request) {
+	var request AcknowledgeRequest
+	if err := decode(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Key == "" && request.Matcher.Empty() {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("acknowledgement needs a key or at least one matcher"))
+		return
+	}
+	var expiresAt time.Time
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", request.Duration))
+			return
+		}
+		expiresAt = time.Now().Add(duration)
+	}
+
+	var targets []notifiers.InstanceStatus
+	for _, alert := range s.escalator.Active() {
+		if request.Key != "" && alert.Key != request.Key {
+			continue
+		}
+		if request.Matcher.Matches(alert.Event.Target) {
+			targets = append(targets, alert.Event.Target)
+		}
+	}
+	// Active alerts are only kept in memory, so after a restart a target that is
+	// still down has none until it is probed again.
+	if len(targets) == 0 && request.Key != "" {
+		target, err := s.unresolvedTarget(request.Key)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if request.Matcher.Matches(target) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no active alert matches"))
+		return
+	}
+
+	acknowledgements := []alerting.Acknowledgement{}
+	for _, target := range targets {
+		ack, err := s.silences.Acknowledge(target.ID, target, request.Author, request.Comment, expiresAt)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		acknowledgements = append(acknowledgements, ack)
+		if s.onAcknowledge != nil {
+			s.onAcknowledge(ack)
+		}
+	}
+	writeJSON(w, http.StatusCreated, acknowledgements)
+}
+
+// unresolvedTarget returns the configured target with id unless it is known to
+// be up.
+func (s *Server) unresolvedTarget(id string) (notifiers.InstanceStatus, error) {
+	for _, target := range s.targets {
+		if target.ID != id {
+			continue
+		}
+		if s.status != nil {
+			for _, status := range s.status().Targets {
+				if status.ID == id && status.Up && status.LastCheck != nil {
+					return target, fmt.Errorf("target %s is up", id)
+				}
+			}
+		}
+		return target, nil
+	}
+	return notifiers.InstanceStatus{}, fmt.Errorf("no active alert or target with key %s", id)
+}
+
+func (s *Server) removeAcknowledgement(w http.ResponseWriter, r *http.Request) {
+	if err := s.silences.RemoveAcknowledgement(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) queueStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.queue.Stats())
+}
+
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, alerting.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
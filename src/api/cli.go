@@ -0,0 +1,417 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/alerting"
+	"github.com/somememoryspace/inframon/src/notifiers"
+)
+
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"alerts":  runAlerts,
+	"ack":     runAck,
+	"silence": runSilence,
+	"status":  runStatus,
+}
+
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := commands[args[0]]
+	return ok
+}
+
+func RunCLI(args []string, stdout io.Writer) error {
+	if !IsCommand(args) {
+		return fmt.Errorf("unknown command")
+	}
+	return commands[args[0]](args[1:], stdout)
+}
+
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr errorResponse
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s (status %d)", apiErr.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) Alerts() ([]alerting.Alert, error) {
+	var alerts []alerting.Alert
+	return alerts, c.do(http.MethodGet, "/api/v1/alerts", nil, &alerts)
+}
+
+func (c *Client) Silences() ([]alerting.Silence, error) {
+	var silences []alerting.Silence
+	return silences, c.do(http.MethodGet, "/api/v1/silences", nil, &silences)
+}
+
+func (c *Client) AddSilence(request SilenceRequest) (alerting.Silence, error) {
+	var silence alerting.Silence
+	return silence, c.do(http.MethodPost, "/api/v1/silences", request, &silence)
+}
+
+func (c *Client) ExpireSilence(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/silences/"+id, nil, nil)
+}
+
+func (c *Client) Acknowledgements() ([]alerting.Acknowledgement, error) {
+	var acknowledgements []alerting.Acknowledgement
+	return acknowledgements, c.do(http.MethodGet, "/api/v1/acknowledgements", nil, &acknowledgements)
+}
+
+func (c *Client) Acknowledge(request AcknowledgeRequest) ([]alerting.Acknowledgement, error) {
+	var acknowledgements []alerting.Acknowledgement
+	return acknowledgements, c.do(http.MethodPost, "/api/v1/acknowledgements", request, &acknowledgements)
+}
+
+func (c *Client) RemoveAcknowledgement(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/acknowledgements/"+id, nil, nil)
+}
+
+type tagsFlag []string
+
+func (t *tagsFlag) String() string { return strings.Join(*t, ",") }
+
+func (t *tagsFlag) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string { return notifiers.FormatLabels(l) }
+
+func (l labelsFlag) Set(value string) error {
+	name, labelValue, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("label must be name=value")
+	}
+	l[name] = labelValue
+	return nil
+}
+
+type commandFlags struct {
+	set      *flag.FlagSet
+	api      *string
+	token    *string
+	author   *string
+	comment  *string
+	duration *string
+	matcher  alerting.Matcher
+	tags     tagsFlag
+	labels   labelsFlag
+}
+
+func newCommandFlags(name string, withMatcher bool) *commandFlags {
+	f := &commandFlags{set: flag.NewFlagSet(name, flag.ContinueOnError), labels: labelsFlag{}}
+	apiURL := os.Getenv("INFRAMON_API")
+	if apiURL == "" {
+		apiURL = "http://" + DefaultListen
+	}
+	f.api = f.set.String("api", apiURL, "base URL of the inframon API. Default: $INFRAMON_API or http://"+DefaultListen)
+	f.token = f.set.String("token", os.Getenv("INFRAMON_API_TOKEN"), "bearer token for the inframon API. Default: $INFRAMON_API_TOKEN")
+	if withMatcher {
+		author := os.Getenv("USER")
+		if current, err := user.Current(); err == nil {
+			author = current.Username
+		}
+		f.author = f.set.String("author", author, "who is acknowledging or silencing. Default: current user")
+		f.comment = f.set.String("comment", "", "free text comment")
+		f.duration = f.set.String("duration", "", "how long it lasts, e.g. 2h")
+		f.set.StringVar(&f.matcher.ID, "id", "", "match the target id")
+		f.set.StringVar(&f.matcher.Address, "address", "", "match the target address")
+		f.set.StringVar(&f.matcher.Service, "service", "", "match the target service")
+		f.set.StringVar(&f.matcher.NetworkZone, "network_zone", "", "match the target networkZone")
+		f.set.StringVar(&f.matcher.InstanceType, "instance_type", "", "match the target instanceType")
+		f.set.StringVar(&f.matcher.Protocol, "protocol", "", "match the target protocol, ICMP or HTTP")
+		f.set.StringVar(&f.matcher.Severity, "severity", "", "match the target severity")
+		f.set.Var(&f.tags, "tag", "match a target tag, can be repeated")
+		f.set.Var(f.labels, "label", "match a target label, as name=value, can be repeated")
+	}
+	return f
+}
+
+func (f *commandFlags) parse(args []string) error {
+	if err := f.set.Parse(args); err != nil {
+		return err
+	}
+	f.matcher.Tags = f.tags
+	if len(f.labels) > 0 {
+		f.matcher.Labels = f.labels
+	}
+	return nil
+}
+
+func (f *commandFlags) client() *Client {
+	return NewClient(*f.api, *f.token)
+}
+
+func runAlerts(args []string, stdout io.Writer) error {
+	f := newCommandFlags("alerts", false)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	alerts, err := f.client().Alerts()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tPROTOCOL\tADDRESS\tSERVICE\tNETWORKZONE\tSINCE\tNOTIFIED")
+	for _, alert := range alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", alert.Key, alert.Event.Target.Protocol, alert.Event.Target.Address, alert.Event.Target.Service, alert.Event.Target.NetworkZone, alert.Event.Since.Format(time.RFC3339), strings.Join(alert.Notified, ","))
+	}
+	return w.Flush()
+}
+
+func runAck(args []string, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "list" {
+		f := newCommandFlags("ack list", false)
+		if err := f.parse(args[1:]); err != nil {
+			return err
+		}
+		acknowledgements, err := f.client().Acknowledgements()
+		if err != nil {
+			return err
+		}
+		printAcknowledgements(stdout, acknowledgements)
+		return nil
+	}
+	if len(args) > 0 && args[0] == "remove" {
+		f := newCommandFlags("ack remove", false)
+		if err := f.parse(args[1:]); err != nil {
+			return err
+		}
+		if f.set.NArg() != 1 {
+			return fmt.Errorf("usage: inframon ack remove [flags] <id>")
+		}
+		return f.client().RemoveAcknowledgement(f.set.Arg(0))
+	}
+
+	f := newCommandFlags("ack", true)
+	key := f.set.String("key", "", "acknowledge the alert with this key, the target id listed by inframon alerts, e.g. icmp-cac7cddfd7f7")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	acknowledgements, err := f.client().Acknowledge(AcknowledgeRequest{
+		Key:      *key,
+		Matcher:  f.matcher,
+		Duration: *f.duration,
+		Author:   *f.author,
+		Comment:  *f.comment,
+	})
+	if err != nil {
+		return err
+	}
+	printAcknowledgements(stdout, acknowledgements)
+	return nil
+}
+
+func runSilence(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: inframon silence <add|list|expire> [flags]")
+	}
+	switch args[0] {
+	case "add":
+		f := newCommandFlags("silence add", true)
+		if err := f.parse(args[1:]); err != nil {
+			return err
+		}
+		silence, err := f.client().AddSilence(SilenceRequest{
+			Matcher:  f.matcher,
+			Duration: *f.duration,
+			Author:   *f.author,
+			Comment:  *f.comment,
+		})
+		if err != nil {
+			return err
+		}
+		printSilences(stdout, []alerting.Silence{silence})
+		return nil
+	case "list":
+		f := newCommandFlags("silence list", false)
+		if err := f.parse(args[1:]); err != nil {
+			return err
+		}
+		silences, err := f.client().Silences()
+		if err != nil {
+			return err
+		}
+		printSilences(stdout, silences)
+		return nil
+	case "expire":
+		f := newCommandFlags("silence expire", false)
+		if err := f.parse(args[1:]); err != nil {
+			return err
+		}
+		if f.set.NArg() != 1 {
+			return fmt.Errorf("usage: inframon silence expire [flags] <id>")
+		}
+		return f.client().ExpireSilence(f.set.Arg(0))
+	default:
+		return fmt.Errorf("unknown silence command %s, expected add, list or expire", args[0])
+	}
+}
+
+func runStatus(args []string, stdout io.Writer) error {
+	set := flag.NewFlagSet("status", flag.ContinueOnError)
+	socket := os.Getenv("INFRAMON_SOCKET")
+	if socket == "" {
+		socket = DefaultStatusSocket
+	}
+	set.StringVar(&socket, "socket", socket, "path of the status socket of the running instance. Default: $INFRAMON_SOCKET or "+DefaultStatusSocket)
+	format := set.String("format", "table", "output format, table or json. Default: table")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("format must be table or json")
+	}
+	if set.NArg() > 0 {
+		// Options may also follow the target id.
+		id := set.Arg(0)
+		if err := set.Parse(set.Args()[1:]); err != nil {
+			return err
+		}
+		if set.NArg() > 0 {
+			return fmt.Errorf("status takes at most one target id")
+		}
+		target, err := NewSocketClient(socket).Target(id)
+		if err != nil {
+			return fmt.Errorf("could not query inframon on %s: %w", socket, err)
+		}
+		if *format == "json" {
+			encoder := json.NewEncoder(stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(target)
+		}
+		return printTargets(stdout, []TargetStatus{target})
+	}
+	status, err := NewSocketClient(socket).Status()
+	if err != nil {
+		return fmt.Errorf("could not query inframon on %s, is it running? %w", socket, err)
+	}
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	down, pending := 0, 0
+	for _, target := range status.Targets {
+		if target.LastCheck == nil {
+			pending++
+		} else if !target.Up {
+			down++
+		}
+	}
+	var queued int
+	for _, stats := range status.Queue {
+		queued += stats.Pending
+	}
+	fmt.Fprintf(stdout, "inframon %s, up %s, %d of %d targets down, %d notifications queued\n\n", status.Version, time.Since(status.StartedAt).Round(time.Second), down, len(status.Targets)-pending, queued)
+	return printTargets(stdout, status.Targets)
+}
+
+func printTargets(stdout io.Writer, targets []TargetStatus) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPROTOCOL\tADDRESS\tSERVICE\tNETWORKZONE\tLABELS\tSTATUS\tSINCE\tLAST CHECK\tLATENCY\tERROR")
+	for _, target := range targets {
+		state, since, lastCheck, latency, labels := "UP", "-", "-", "-", "-"
+		switch {
+		case target.LastCheck == nil:
+			state = "PENDING"
+		case !target.Up && target.Silenced:
+			state = "DOWN (silenced)"
+		case !target.Up && target.Acknowledged:
+			state = "DOWN (acked)"
+		case !target.Up:
+			state = "DOWN"
+		}
+		if target.Since != nil {
+			since = target.Since.Format(time.RFC3339)
+		}
+		if target.LastCheck != nil {
+			lastCheck = time.Since(*target.LastCheck).Round(time.Second).String() + " ago"
+		}
+		if target.Up && target.LastCheck != nil {
+			latency = fmt.Sprintf("%dms", target.LatencyMs)
+		}
+		if len(target.Labels) > 0 {
+			labels = notifiers.FormatLabels(target.Labels)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", target.ID, target.Protocol, target.Address, target.Service, target.NetworkZone, labels, state, since, lastCheck, latency, target.LastError)
+	}
+	return w.Flush()
+}
+
+func printAcknowledgements(stdout io.Writer, acknowledgements []alerting.Acknowledgement) {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKEY\tAUTHOR\tCREATED\tEXPIRES\tCOMMENT")
+	for _, ack := range acknowledgements {
+		expires := "on recovery"
+		if !ack.ExpiresAt.IsZero() {
+			expires = ack.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", ack.ID, ack.Key, ack.Author, ack.CreatedAt.Format(time.RFC3339), expires, ack.Comment)
+	}
+	w.Flush()
+}
+
+func printSilences(stdout io.Writer, silences []alerting.Silence) {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMATCHER\tAUTHOR\tENDS\tCOMMENT")
+	for _, silence := range silences {
+		matcher, _ := json.Marshal(silence.Matcher)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", silence.ID, matcher, silence.Author, silence.EndsAt.Format(time.RFC3339), silence.Comment)
+	}
+	w.Flush()
+}
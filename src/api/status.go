@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/somememoryspace/inframon/src/alerting"
+)
+
+// DefaultStatusSocket is where a running instance answers `inframon status` unless
+// statusSocket is set. It is in a directory only the user inframon runs as can enter:
+// /run/inframon for root, $XDG_RUNTIME_DIR/inframon for other users if it is set.
+var DefaultStatusSocket = filepath.Join(runtimeDirectory(), "inframon", "inframon.sock")
+
+func runtimeDirectory() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Getuid() != 0 {
+		return dir
+	}
+	return "/run"
+}
+
+type TargetStatus struct {
+	ID           string            `json:"id"`
+	Protocol     string            `json:"protocol"`
+	Address      string            `json:"address"`
+	Service      string            `json:"service"`
+	NetworkZone  string            `json:"networkZone"`
+	InstanceType string            `json:"instanceType"`
+	Severity     string            `json:"severity"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Up           bool              `json:"up"`
+	Since        *time.Time        `json:"since,omitempty"`
+	LastCheck    *time.Time        `json:"lastCheck,omitempty"`
+	LatencyMs    int64             `json:"latencyMs,omitempty"`
+	ResponseCode int               `json:"responseCode,omitempty"`
+	LastError    string            `json:"lastError,omitempty"`
+	Acknowledged bool              `json:"acknowledged,omitempty"`
+	Silenced     bool              `json:"silenced,omitempty"`
+}
+
+type Status struct {
+	Version   string                         `json:"version"`
+	StartedAt time.Time                      `json:"startedAt"`
+	Targets   []TargetStatus                 `json:"targets"`
+	Queue     map[string]alerting.QueueStats `json:"queue"`
+}
+
+func (s *Server) showStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+func (s *Server) showTarget(w http.ResponseWriter, r *http.Request) {
+	for _, target := range s.status().Targets {
+		if target.ID == r.PathValue("id") {
+			writeJSON(w, http.StatusOK, target)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("no target with id %s", r.PathValue("id")))
+}
+
+// ListenStatus creates the Unix socket of the status requests at path. The socket
+// is only accessible to the user inframon runs as and its group, which replaces the
+// token. The directory of the default socket is created if needed and is only
+// accessible to the user. It sets the umask of the process for a moment, so it must
+// be called before anything else runs.
+func ListenStatus(path string) (net.Listener, error) {
+	if path == DefaultStatusSocket {
+		if err := privateDirectory(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	// The socket is created with its final permissions, so no one else can connect
+	// to it before they are set.
+	mask := syscall.Umask(0117)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
+
+// ServeStatus answers status requests on a listener from ListenStatus.
+func (s *Server) ServeStatus(listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", s.showStatus)
+	mux.HandleFunc("GET /api/v1/status/{id}", s.showTarget)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return server.Serve(listener)
+}
+
+// privateDirectory creates dir with mode 0700, or makes sure an existing one is a
+// directory of the current user that no one else can enter.
+func privateDirectory(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not a directory owned by the user inframon runs as", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("failed to set permissions of %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// removeStaleSocket removes a socket left behind by an instance that did not shut
+// down cleanly. A socket that still answers is not removed, and neither is anything
+// that is not a socket.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another instance is listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// NewSocketClient returns a client for the status socket of a running instance.
+func NewSocketClient(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{baseURL: "http://inframon", client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+}
+
+func (c *Client) Status() (Status, error) {
+	var status Status
+	return status, c.do(http.MethodGet, "/api/v1/status", nil, &status)
+}
+
+func (c *Client) Target(id string) (TargetStatus, error) {
+	var target TargetStatus
+	return target, c.do(http.MethodGet, "/api/v1/status/"+url.PathEscape(id), nil, &target)
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/somememoryspace/inframon/src/alerting"
+	"github.com/somememoryspace/inframon/src/api"
 	"github.com/somememoryspace/inframon/src/connectors"
 	"github.com/somememoryspace/inframon/src/notifiers"
 	"github.com/somememoryspace/inframon/src/utils"
@@ -17,22 +26,79 @@ import (
 
 var (
 	MUTEX              sync.Mutex
-	ROOTUSERARG        = flag.Bool("root_user", false, "True / False for enabling privileged mode. Default: False")
-	CONFIGARG          = flag.String("config", "", "path/to/file targeting inframon config.yaml file. Default: Nothing")
-	LOGPATHARG         = flag.String("logpath", "", "path/to/logfile targeting inframon log file. Default: Nothing")
-	LOGNAMEARG         = flag.String("logname", "", "file name for the log file. Default: Nothing")
+	RUNFLAGS           = flag.NewFlagSet("run", flag.ExitOnError)
+	ROOTUSERARG        = RUNFLAGS.Bool("root_user", false, "True / False for enabling privileged mode. Default: False")
+	CONFIGARG          = RUNFLAGS.String("config", "", "path/to/file targeting inframon config.yaml file, or a directory of them. Default: Nothing")
+	LOGPATHARG         = RUNFLAGS.String("logpath", "", "path/to/logfile targeting inframon log file. Default: Nothing")
+	LOGNAMEARG         = RUNFLAGS.String("logname", "", "file name for the log file. Default: Nothing")
+	VERSION            = "dev"
+	STARTEDAT          time.Time
 	CONFIG             *utils.Config
 	LOGGER             *utils.SafeLogger
 	ICMPHEALTH         = make(map[string]bool)
 	HTTPHEALTH         = make(map[string]bool)
+	DOWNSINCE          = make(map[string]time.Time)
+	LASTPROBE          = make(map[string]probeResult)
 	DISCORDDISABLE     bool
 	HEALTHCHECKTIMEOUT int
 	STDOUT             bool
 	CRONSCHEDULE       *utils.CronSchedule
+	TEMPLATES          *notifiers.Templates
+	NOTIFIERS          map[string]notifiers.Notifier
+	ROUTER             *alerting.Router
+	ESCALATOR          *alerting.Escalator
+	SILENCES           *alerting.Silences
+	DIGEST             *alerting.Digest
+	QUEUE              *alerting.Queue
+	SCHEDULES          *alerting.Schedules
+	STATUSLISTENER     net.Listener
 )
 
-func init() {
-	flag.Parse()
+// COMMANDS are the subcommands of inframon. The ones that talk to the API of a
+// running instance are in the api package.
+var COMMANDS = map[string]func(args []string) error{
+	"run":         runDaemon,
+	"check":       runCheck,
+	"notify-test": runNotifyTest,
+	"schema":      runSchema,
+	"validate":    runValidate,
+	"version":     runVersion,
+}
+
+const USAGE = `Usage: inframon <command> [flags]
+
+Commands:
+  run          start monitoring, the default when no command is given
+  check        probe targets once and exit
+  validate     check a configuration file
+  schema       print the JSON Schema of the configuration file
+  status       show the live target state of a running instance
+  notify-test  send sample notifications through the notifiers
+  alerts       list the active alerts of a running instance
+  ack          acknowledge alerts of a running instance
+  silence      silence targets of a running instance
+  version      print the version
+
+Run 'inframon <command> -h' for the flags of a command.
+`
+
+// exitCodeError makes a subcommand exit with a code other than 1.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+type probeResult struct {
+	lastCheck    time.Time
+	latency      time.Duration
+	responseCode int
+	lastError    string
+}
+
+func setup(args []string) {
+	RUNFLAGS.Parse(args)
 	if *CONFIGARG == "" {
 		log.Fatal("no configuration path provided")
 	}
@@ -88,6 +154,49 @@ func init() {
 		log.Fatalf("configuration validation failed: %v", err)
 	}
 
+	if !CONFIG.Configuration.StatusSocketDisable {
+		STATUSLISTENER, err = api.ListenStatus(statusSocket())
+		if err != nil {
+			utils.ConsoleAndLoggerOutput(LOGGER, "STATUS", fmt.Sprintf("Could not create status socket :: [%s]", err), "ERROR")
+		}
+	}
+
+	TEMPLATES, err = notifiers.LoadTemplates(CONFIG.Configuration.Templates)
+	if err != nil {
+		log.Fatalf("invalid notification templates: %v", err)
+	}
+
+	NOTIFIERS, err = alerting.BuildNotifiers(CONFIG, TEMPLATES)
+	if err != nil {
+		log.Fatalf("invalid notifier configuration: %v", err)
+	}
+	ROUTER = alerting.NewRouter(CONFIG)
+	ESCALATOR = alerting.NewEscalator(CONFIG)
+	SILENCES, err = alerting.LoadSilences(CONFIG.Configuration.StateDirectory)
+	if err != nil {
+		log.Fatalf("could not load silences: %v", err)
+	}
+	if err := SILENCES.MigrateAcknowledgements(alerting.Targets(CONFIG)); err != nil {
+		log.Fatalf("could not migrate acknowledgements: %v", err)
+	}
+	SCHEDULES, err = alerting.LoadSchedules(CONFIG, CONFIG.Configuration.StateDirectory)
+	if err != nil {
+		log.Fatalf("could not load delivery schedules: %v", err)
+	}
+	QUEUE, err = alerting.NewQueue(CONFIG.Configuration.StateDirectory, CONFIG.Configuration.QueueMaxAttempts, LOGGER, deliver)
+	if err != nil {
+		log.Fatalf("could not create notification queue: %v", err)
+	}
+	resumed, err := QUEUE.Resume(NOTIFIERS)
+	if err != nil {
+		log.Fatalf("could not resume notification queue: %v", err)
+	}
+	if CONFIG.Configuration.DigestWindow > 0 {
+		DIGEST = alerting.NewDigest(time.Duration(CONFIG.Configuration.DigestWindow)*time.Second, CONFIG.Configuration.DigestMaxEvents, func(name string, event notifiers.Event) {
+			enqueue(name, event)
+		})
+	}
+
 	DISCORDDISABLE = CONFIG.Configuration.DiscordWebHookDisable
 	HEALTHCHECKTIMEOUT = CONFIG.Configuration.HealthCheckTimeout
 
@@ -97,6 +206,19 @@ func init() {
 	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("healthCheckTimeout :: [%v]", CONFIG.Configuration.HealthCheckTimeout), "INFO")
 	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("discordWebhookDisable :: [%v]", CONFIG.Configuration.DiscordWebHookDisable), "INFO")
 	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("smtpDisable :: [%v]", CONFIG.Configuration.SmtpDisable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("pagerDutyEnable :: [%v]", CONFIG.Configuration.PagerDutyEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("alertmanagerEnable :: [%v]", CONFIG.Configuration.AlertmanagerEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("opsgenieEnable :: [%v]", CONFIG.Configuration.OpsgenieEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("webhookEnable :: [%v]", CONFIG.Configuration.WebhookEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("matrixEnable :: [%v]", CONFIG.Configuration.MatrixEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("notifiers :: [%d] routes :: [%d] defaultRoute :: %v", len(NOTIFIERS), len(CONFIG.Routes), ROUTER.Defaults()), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("queuedNotificationsResumed :: [%d]", resumed), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("escalationPolicies :: [%d]", len(CONFIG.EscalationPolicies)), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("apiEnable :: [%v]", CONFIG.Configuration.APIEnable), "INFO")
+	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", fmt.Sprintf("digestWindow :: [%v]", CONFIG.Configuration.DigestWindow), "INFO")
+	if CONFIG.Configuration.StateDirectory == "" {
+		utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", "stateDirectory is not set, silences and acknowledgements are lost on restart", "INFO")
+	}
 }
 
 func setHealthStatus(m map[string]bool, key string, value bool) {
@@ -111,63 +233,143 @@ func getHealthStatus(m map[string]bool, key string) bool {
 	return m[key]
 }
 
-func pingTaskICMP(privileged bool, address string, service string, retryBuffer int, timeout int, failureTimeout int, networkZone string, instanceType string, wg *sync.WaitGroup) {
+func setDownSince(key string, value time.Time) {
+	MUTEX.Lock()
+	defer MUTEX.Unlock()
+	if value.IsZero() {
+		delete(DOWNSINCE, key)
+		return
+	}
+	DOWNSINCE[key] = value
+}
+
+func getDownSince(key string) time.Time {
+	MUTEX.Lock()
+	defer MUTEX.Unlock()
+	return DOWNSINCE[key]
+}
+
+func setLastProbe(key string, latency time.Duration, responseCode int, err error) {
+	result := probeResult{lastCheck: time.Now(), latency: latency, responseCode: responseCode}
+	if err != nil {
+		result.lastError = err.Error()
+	}
+	MUTEX.Lock()
+	defer MUTEX.Unlock()
+	LASTPROBE[key] = result
+}
+
+func getLastProbe(key string) probeResult {
+	MUTEX.Lock()
+	defer MUTEX.Unlock()
+	return LASTPROBE[key]
+}
+
+func newTransitionEvent(message string, status string, instance notifiers.InstanceStatus, latency time.Duration, err error) notifiers.Event {
+	event := notifiers.Event{
+		Kind:        notifiers.EventKindTransition,
+		Title:       status,
+		Description: message,
+		State:       notifiers.StateUp,
+		Target:      instance,
+		Latency:     latency,
+		Timestamp:   time.Now(),
+		Since:       getDownSince(instance.ID),
+	}
+	if !instance.Status {
+		event.State = notifiers.StateDown
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// describeTarget is how a target is written in the log.
+func describeTarget(instance notifiers.InstanceStatus) string {
+	description := fmt.Sprintf("ID: [%s] Address: [%s] Service: [%s] NetworkZone: [%s] InstanceType: [%s]", instance.ID, instance.Address, instance.Service, instance.NetworkZone, instance.InstanceType)
+	if len(instance.Labels) > 0 {
+		description += fmt.Sprintf(" Labels: [%s]", notifiers.FormatLabels(instance.Labels))
+	}
+	return description
+}
+
+func pingTaskICMP(privileged bool, target utils.ICMPTarget, wg *sync.WaitGroup) {
 	defer wg.Done()
+	id := target.ID
+	instance := alerting.TargetInstance(target.Protocol(), target.TargetMeta)
 	for {
-		latency, err := connectors.PingICMP(address, privileged, retryBuffer, failureTimeout)
+		latency, err := connectors.PingICMP(target.Address, privileged, target.RetryBuffer, target.FailureTimeout)
+		setLastProbe(id, latency, 0, err)
 		if latency == 0 {
-			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP KO", fmt.Sprintf("Address: [%s] Service: [%s] NetworkZone: [%s] InstanceType: [%s] Latency: [%v] Error: [%v]", address, service, networkZone, instanceType, latency, err), "ERROR")
-			if getHealthStatus(ICMPHEALTH, address) {
-				setHealthStatus(ICMPHEALTH, address, false)
-				sendNotification("ICMP Monitor", "Connection Interrupted", address, service, networkZone, instanceType, 0xFF0000, latency)
+			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP KO", fmt.Sprintf("%s Latency: [%v] Error: [%v]", describeTarget(instance), latency, err), "ERROR")
+			instance.Status = false
+			if getHealthStatus(ICMPHEALTH, id) {
+				setHealthStatus(ICMPHEALTH, id, false)
+				setDownSince(id, time.Now())
+				sendNotification(newTransitionEvent("ICMP Monitor", "Connection Interrupted", instance, latency, err))
+			} else {
+				refreshAlertmanager(newTransitionEvent("ICMP Monitor", "Connection Interrupted", instance, latency, err))
 			}
 		} else {
-			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP OK", fmt.Sprintf("Address: [%s] Service: [%s] NetworkZone: [%s] InstanceType: [%s] Latency: [%v]", address, service, networkZone, instanceType, latency), "INFO")
-			if !getHealthStatus(ICMPHEALTH, address) {
-				setHealthStatus(ICMPHEALTH, address, true)
-				sendNotification("ICMP Monitor", "Connection Established", address, service, networkZone, instanceType, 0x00FF00, latency)
+			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP OK", fmt.Sprintf("%s Latency: [%v]", describeTarget(instance), latency), "INFO")
+			instance.Status = true
+			if !getHealthStatus(ICMPHEALTH, id) {
+				setHealthStatus(ICMPHEALTH, id, true)
+				sendNotification(newTransitionEvent("ICMP Monitor", "Connection Established", instance, latency, nil))
+				setDownSince(id, time.Time{})
 			}
 		}
-		time.Sleep(time.Duration(timeout) * time.Second)
+		time.Sleep(time.Duration(target.Timeout) * time.Second)
 	}
 }
 
-func pingTaskHTTP(address string, service string, retryBuffer int, timeout int, failureTimeout int, skipVerify bool, networkZone string, instanceType string, wg *sync.WaitGroup) {
+func pingTaskHTTP(target utils.HTTPTarget, wg *sync.WaitGroup) {
 	defer wg.Done()
+	id := target.ID
+	instance := alerting.TargetInstance(target.Protocol(), target.TargetMeta)
 	for {
-		respCode, err := connectors.PingHTTP(address, service, skipVerify, retryBuffer, failureTimeout)
+		start := time.Now()
+		respCode, err := connectors.PingHTTP(target.Address, target.Service, target.SkipVerify, target.RetryBuffer, target.FailureTimeout)
+		setLastProbe(id, time.Since(start), respCode, err)
 		if err != nil || respCode == 0 {
-			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP KO", fmt.Sprintf("Address: [%s] Service: [%s] NetworkZone: [%s] InstanceType: [%s] Response: [%d] Error: [%v]", address, service, networkZone, instanceType, respCode, err), "ERROR")
-			if getHealthStatus(HTTPHEALTH, address) {
-				setHealthStatus(HTTPHEALTH, address, false)
-				sendNotification("HTTP Monitor", "Connection Interrupted", address, service, networkZone, instanceType, 0xFF0000, 0)
+			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP KO", fmt.Sprintf("%s Response: [%d] Error: [%v]", describeTarget(instance), respCode, err), "ERROR")
+			instance.Status = false
+			if getHealthStatus(HTTPHEALTH, id) {
+				setHealthStatus(HTTPHEALTH, id, false)
+				setDownSince(id, time.Now())
+				sendNotification(newTransitionEvent("HTTP Monitor", "Connection Interrupted", instance, 0, err))
+			} else {
+				refreshAlertmanager(newTransitionEvent("HTTP Monitor", "Connection Interrupted", instance, 0, err))
 			}
 		} else if respCode == 200 || respCode == 201 || respCode == 204 {
-			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP OK", fmt.Sprintf("Address: [%s] Service: [%s] NetworkZone: [%s] InstanceType: [%s] Response: [%d]", address, service, networkZone, instanceType, respCode), "INFO")
-			if !getHealthStatus(HTTPHEALTH, address) {
-				setHealthStatus(HTTPHEALTH, address, true)
-				sendNotification("HTTP Monitor", "Connection Established", address, service, networkZone, instanceType, 0x00FF00, 0)
+			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP OK", fmt.Sprintf("%s Response: [%d]", describeTarget(instance), respCode), "INFO")
+			instance.Status = true
+			if !getHealthStatus(HTTPHEALTH, id) {
+				setHealthStatus(HTTPHEALTH, id, true)
+				sendNotification(newTransitionEvent("HTTP Monitor", "Connection Established", instance, 0, nil))
+				setDownSince(id, time.Time{})
 			}
 		}
-		time.Sleep(time.Duration(timeout) * time.Second)
+		time.Sleep(time.Duration(target.Timeout) * time.Second)
 	}
 }
 
 func healthCheck(timeout int) {
 	for {
-		for address := range ICMPHEALTH {
+		for _, icmpConfig := range CONFIG.ICMP {
 			status := "PASS"
-			if !getHealthStatus(ICMPHEALTH, address) {
+			if !getHealthStatus(ICMPHEALTH, icmpConfig.ID) {
 				status = "FAIL"
 			}
-			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP HEALTH", fmt.Sprintf("Health [%s] Address [%s]", status, address), "INFO")
+			utils.ConsoleAndLoggerOutput(LOGGER, "ICMP HEALTH", fmt.Sprintf("Health [%s] ID [%s] Address [%s]", status, icmpConfig.ID, icmpConfig.Address), "INFO")
 		}
-		for address := range HTTPHEALTH {
+		for _, httpConfig := range CONFIG.HTTP {
 			status := "PASS"
-			if !getHealthStatus(HTTPHEALTH, address) {
+			if !getHealthStatus(HTTPHEALTH, httpConfig.ID) {
 				status = "FAIL"
 			}
-			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP HEALTH", fmt.Sprintf("Health [%s] Address [%s]", status, address), "INFO")
+			utils.ConsoleAndLoggerOutput(LOGGER, "HTTP HEALTH", fmt.Sprintf("Health [%s] ID [%s] Address [%s]", status, httpConfig.ID, httpConfig.Address), "INFO")
 		}
 		time.Sleep(time.Duration(timeout) * time.Second)
 	}
@@ -197,140 +399,326 @@ func sendStatusSummary() error {
 	var httpStatuses []notifiers.InstanceStatus
 
 	for _, icmpConfig := range CONFIG.ICMP {
-		status := notifiers.InstanceStatus{
-			Address:      icmpConfig.Address,
-			Service:      icmpConfig.Service,
-			NetworkZone:  icmpConfig.NetworkZone,
-			InstanceType: icmpConfig.InstanceType,
-			Protocol:     "ICMP",
-			Status:       getHealthStatus(ICMPHEALTH, icmpConfig.Address),
-		}
+		status := alerting.TargetInstance(icmpConfig.Protocol(), icmpConfig.TargetMeta)
+		status.Status = getHealthStatus(ICMPHEALTH, icmpConfig.ID)
 		icmpStatuses = append(icmpStatuses, status)
 	}
 
 	for _, httpConfig := range CONFIG.HTTP {
-		status := notifiers.InstanceStatus{
-			Address:      httpConfig.Address,
-			Service:      httpConfig.Service,
-			NetworkZone:  httpConfig.NetworkZone,
-			InstanceType: httpConfig.InstanceType,
-			Protocol:     "HTTP",
-			Status:       getHealthStatus(HTTPHEALTH, httpConfig.Address),
-		}
+		status := alerting.TargetInstance(httpConfig.Protocol(), httpConfig.TargetMeta)
+		status.Status = getHealthStatus(HTTPHEALTH, httpConfig.ID)
 		httpStatuses = append(httpStatuses, status)
 	}
 
-	var discordErr, smtpErr error
+	summaryEvent := notifiers.Event{
+		Kind:      notifiers.EventKindSummary,
+		Title:     "Scheduled Report",
+		Timestamp: time.Now(),
+		Statuses:  append(icmpStatuses, httpStatuses...),
+	}
 
-	// Send Discord notification
-	discordErr = notifiers.SendStatusSummaryToDiscord(
-		CONFIG.Configuration.HealthCronWebhookDisable,
-		DISCORDDISABLE,
-		CONFIG.Configuration.DiscordWebHookURL,
-		icmpStatuses,
-		httpStatuses,
-		0,
-		5*time.Second,
-		5,
-	)
+	if err := dispatch(ROUTER.Defaults(), summaryEvent); err != nil {
+		return fmt.Errorf("failed to send status summary: %v", err)
+	}
 
-	// Send SMTP notification
-	smtpErr = notifiers.SendStatusSummaryToSMTP(
-		CONFIG.Configuration.SmtpDisable,
-		CONFIG.Configuration.HealthCronSmtpDisable,
-		CONFIG.Configuration.SmtpUsername,
-		CONFIG.Configuration.SmtpPassword,
-		CONFIG.Configuration.SmtpHost,
-		CONFIG.Configuration.SmtpTo,
-		CONFIG.Configuration.SmtpFrom,
-		CONFIG.Configuration.SmtpPort,
-		icmpStatuses,
-		httpStatuses,
-	)
+	return nil
+}
 
-	// Log errors if any
-	if discordErr != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "DISCORD STATUS SUMMARY", fmt.Sprintf("Failed to send Discord status summary: %v", discordErr), "ERROR")
+func sendNotification(event notifiers.Event) {
+	now := time.Now()
+	key := event.Target.ID
+	if ack := SILENCES.Acknowledged(key, now); ack != nil {
+		event.Acknowledgement = ack.Notification()
 	}
-	if smtpErr != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "SMTP STATUS SUMMARY", fmt.Sprintf("Failed to send SMTP status summary: %v", smtpErr), "ERROR")
+	names := ROUTER.Route(event.Target)
+	if event.State == notifiers.StateDown {
+		names = alerting.MergeNames(names, ESCALATOR.Start(key, ROUTER.Escalation(event.Target), event, now))
+	} else {
+		names = alerting.MergeNames(names, ESCALATOR.Stop(key))
+		if err := SILENCES.ClearAcknowledgement(key); err != nil {
+			utils.ConsoleAndLoggerOutput(LOGGER, "ACKNOWLEDGEMENT", fmt.Sprintf("Unable to clear acknowledgement of [%s] :: [%s]", key, err), "ERROR")
+		}
+	}
+	if silence := SILENCES.Silenced(event.Target, now); silence != nil {
+		utils.ConsoleAndLoggerOutput(LOGGER, "SILENCE", fmt.Sprintf("Notification for [%s] suppressed by silence [%s]", key, silence.ID), "INFO")
+		return
 	}
+	dispatch(names, event)
+}
+
+func notificationHeld(key string, event notifiers.Event) bool {
+	now := time.Now()
+	return SILENCES.Acknowledged(key, now) != nil || SILENCES.Silenced(event.Target, now) != nil
+}
 
-	// Return an error if either notification failed
-	if discordErr != nil || smtpErr != nil {
-		return fmt.Errorf("failed to send status summary: Discord error: %v, SMTP error: %v", discordErr, smtpErr)
+func escalationTasks() {
+	for {
+		for _, escalation := range ESCALATOR.Due(time.Now(), notificationHeld) {
+			utils.ConsoleAndLoggerOutput(LOGGER, "ESCALATION", fmt.Sprintf("Escalating [%s] step [%d] to %v", escalation.Key, escalation.Step, escalation.Notifiers), "INFO")
+			dispatch(escalation.Notifiers, escalation.Event)
+		}
+		time.Sleep(1 * time.Second)
 	}
+}
 
-	return nil
+// scheduleTasks releases the transitions held for notifiers outside their delivery
+// window, as one digest where the notifier supports it.
+func scheduleTasks() {
+	maxEvents := CONFIG.Configuration.DigestMaxEvents
+	if maxEvents == 0 {
+		maxEvents = alerting.DefaultDigestMaxEvents
+	}
+	for {
+		due, err := SCHEDULES.Due(time.Now())
+		if err != nil {
+			utils.ConsoleAndLoggerOutput(LOGGER, "SCHEDULE", fmt.Sprintf("Unable to persist held notifications :: [%s]", err), "ERROR")
+		}
+		for name, events := range due {
+			notifier, ok := NOTIFIERS[name]
+			if !ok {
+				continue
+			}
+			utils.ConsoleAndLoggerOutput(LOGGER, "SCHEDULE", fmt.Sprintf("Delivery window of [%s] opened, releasing [%d] held notifications", name, len(events)), "INFO")
+			if len(events) > 1 && notifiers.SupportsDigest(notifier) {
+				enqueue(name, notifiers.NewDigestEvent(events, maxEvents))
+				continue
+			}
+			for _, event := range events {
+				enqueue(name, event)
+			}
+		}
+		time.Sleep(15 * time.Second)
+	}
 }
 
-func sendNotification(message string, status string, address string, service string, networkZone string, instanceType string, color int, latency time.Duration) {
-	var errDiscord error
-	var errSmtp error
-	errDiscord = notifiers.SendToDiscordWebhook(DISCORDDISABLE, CONFIG.Configuration.DiscordWebHookURL, status, message, color, address, service, networkZone, instanceType, 0, 5*time.Second, 5)
-	errSmtp = notifiers.SendSMTPMail(
-		CONFIG.Configuration.SmtpDisable,
-		CONFIG.Configuration.SmtpUsername,
-		CONFIG.Configuration.SmtpPassword,
-		CONFIG.Configuration.SmtpHost,
-		CONFIG.Configuration.SmtpTo,
-		CONFIG.Configuration.SmtpFrom,
-		CONFIG.Configuration.SmtpPort,
-		status, message, address, service, networkZone, instanceType,
-	)
-	if errDiscord != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "DISCORD NOTIFICATION", fmt.Sprintf("Unable to send discord webhook notification :: [%s]", errDiscord), "ERROR")
-	} else {
-		utils.ConsoleAndLoggerOutput(LOGGER, "DISCORD NOTIFICATION", "Successfully sent discord webhook notification", "INFO")
+func sendAcknowledgement(ack alerting.Acknowledgement) {
+	utils.ConsoleAndLoggerOutput(LOGGER, "ACKNOWLEDGEMENT", fmt.Sprintf("Alert [%s] acknowledged by [%s] :: [%s]", ack.Key, ack.Author, ack.Comment), "INFO")
+	description := fmt.Sprintf("%s %s (%s) acknowledged by %s", ack.Target.Protocol, ack.Target.Address, ack.Target.Service, ack.Author)
+	if ack.Comment != "" {
+		description += ": " + ack.Comment
 	}
-	if errSmtp != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "SMTP NOTIFICATION", fmt.Sprintf("Unable to send smtp push notification :: [%s]", errSmtp), "ERROR")
-	} else {
-		utils.ConsoleAndLoggerOutput(LOGGER, "SMTP NOTIFICATION", "Successfully sent smtp push notification", "INFO")
+	event := notifiers.Event{
+		Kind:            notifiers.EventKindSystem,
+		Title:           "Alert Acknowledged",
+		Description:     description,
+		Target:          ack.Target,
+		Timestamp:       ack.CreatedAt,
+		Acknowledgement: ack.Notification(),
+	}
+	dispatch(alerting.MergeNames(ROUTER.Route(ack.Target), ESCALATOR.Notified(ack.Key)), event)
+}
+
+func apiTasks() {
+	listen := CONFIG.Configuration.APIListen
+	if listen == "" {
+		listen = api.DefaultListen
+	}
+	utils.ConsoleAndLoggerOutput(LOGGER, "API", fmt.Sprintf("Listening on [%s]", listen), "INFO")
+	server := api.NewServer(SILENCES, ESCALATOR, QUEUE, currentStatus, alerting.Targets(CONFIG), CONFIG.Configuration.APIToken, sendAcknowledgement)
+	if err := server.ListenAndServe(listen); err != nil {
+		utils.ConsoleAndLoggerOutput(LOGGER, "API", fmt.Sprintf("API server stopped :: [%s]", err), "ERROR")
+	}
+}
+
+func statusSocket() string {
+	if CONFIG.Configuration.StatusSocket != "" {
+		return CONFIG.Configuration.StatusSocket
+	}
+	return api.DefaultStatusSocket
+}
+
+func statusTasks() {
+	socket := statusSocket()
+	utils.ConsoleAndLoggerOutput(LOGGER, "STATUS", fmt.Sprintf("Listening on [%s]", socket), "INFO")
+	server := api.NewServer(SILENCES, ESCALATOR, QUEUE, currentStatus, alerting.Targets(CONFIG), "", nil)
+	if err := server.ServeStatus(STATUSLISTENER); err != nil && !errors.Is(err, net.ErrClosed) {
+		utils.ConsoleAndLoggerOutput(LOGGER, "STATUS", fmt.Sprintf("Status socket stopped :: [%s]", err), "ERROR")
+	}
+}
+
+func currentStatus() api.Status {
+	now := time.Now()
+	status := api.Status{Version: VERSION, StartedAt: STARTEDAT, Targets: []api.TargetStatus{}, Queue: QUEUE.Stats()}
+	add := func(instance notifiers.InstanceStatus, health map[string]bool) {
+		id := instance.ID
+		probe := getLastProbe(id)
+		target := api.TargetStatus{
+			ID:           id,
+			Protocol:     instance.Protocol,
+			Address:      instance.Address,
+			Service:      instance.Service,
+			NetworkZone:  instance.NetworkZone,
+			InstanceType: instance.InstanceType,
+			Severity:     instance.Severity,
+			Labels:       instance.Labels,
+			Up:           getHealthStatus(health, id),
+			LatencyMs:    probe.latency.Milliseconds(),
+			ResponseCode: probe.responseCode,
+			LastError:    probe.lastError,
+		}
+		if since := getDownSince(id); !since.IsZero() {
+			target.Since = &since
+		}
+		if !probe.lastCheck.IsZero() {
+			target.LastCheck = &probe.lastCheck
+		}
+		if !target.Up {
+			target.Acknowledged = SILENCES.Acknowledged(id, now) != nil
+			target.Silenced = SILENCES.Silenced(instance, now) != nil
+		}
+		status.Targets = append(status.Targets, target)
+	}
+	for _, icmpConfig := range CONFIG.ICMP {
+		add(alerting.TargetInstance(icmpConfig.Protocol(), icmpConfig.TargetMeta), ICMPHEALTH)
+	}
+	for _, httpConfig := range CONFIG.HTTP {
+		add(alerting.TargetInstance(httpConfig.Protocol(), httpConfig.TargetMeta), HTTPHEALTH)
+	}
+	return status
+}
+
+func dispatch(names []string, event notifiers.Event) error {
+	var errs []error
+	for _, name := range names {
+		notifier, ok := NOTIFIERS[name]
+		if !ok {
+			continue
+		}
+		held, err := SCHEDULES.Hold(name, event, time.Now())
+		if err != nil {
+			utils.ConsoleAndLoggerOutput(LOGGER, "SCHEDULE", fmt.Sprintf("Unable to persist held notifications :: [%s]", err), "ERROR")
+		}
+		if held {
+			utils.ConsoleAndLoggerOutput(LOGGER, "SCHEDULE", fmt.Sprintf("Holding %s notification to [%s] until its delivery window opens", event.Kind, name), "INFO")
+			continue
+		}
+		if DIGEST != nil && event.Kind == notifiers.EventKindTransition && notifiers.SupportsDigest(notifier) {
+			DIGEST.Add(name, event)
+			continue
+		}
+		if err := enqueue(name, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func enqueue(name string, event notifiers.Event) error {
+	err := QUEUE.Enqueue(name, event)
+	if err != nil {
+		utils.ConsoleAndLoggerOutput(LOGGER, "QUEUE", fmt.Sprintf("Unable to queue %s notification to [%s] :: [%s]", event.Kind, name, err), "ERROR")
+	}
+	return err
+}
+
+func deliver(name string, event notifiers.Event) error {
+	notifier := NOTIFIERS[name]
+	category := fmt.Sprintf("%s NOTIFICATION", strings.ToUpper(notifier.Type()))
+	err := notifier.Send(event)
+	if errors.Is(err, notifiers.ErrEventNotSupported) {
+		return nil
+	}
+	if err != nil {
+		utils.ConsoleAndLoggerOutput(LOGGER, category, fmt.Sprintf("Unable to send %s notification to [%s] :: [%s]", event.Kind, name, err), "ERROR")
+	} else if event.Kind != notifiers.EventKindRefresh {
+		utils.ConsoleAndLoggerOutput(LOGGER, category, fmt.Sprintf("Successfully sent %s notification to [%s]", event.Kind, name), "INFO")
+	}
+	return err
+}
+
+// Alertmanager expires alerts that are not re-sent within its resolve_timeout,
+// so firing alerts are refreshed on every failed probe while a target stays down.
+// Refreshes go through the queue so that a slow Alertmanager does not hold up
+// the probe.
+func refreshAlertmanager(event notifiers.Event) {
+	if SILENCES.Silenced(event.Target, time.Now()) != nil {
+		return
+	}
+	event.Kind = notifiers.EventKindRefresh
+	for _, name := range ROUTER.Route(event.Target) {
+		if _, ok := NOTIFIERS[name].(*notifiers.AlertmanagerNotifier); ok {
+			enqueue(name, event)
+		}
 	}
 }
 
 func sendNotificationSystem(message string, status string) {
-	var errDiscord error
-	var errSmtp error
-	errDiscord = notifiers.SendToDiscordWebhookSystem(DISCORDDISABLE, CONFIG.Configuration.DiscordWebHookURL, status, message, 0x4682B4, 0, 5*time.Second, 5)
-	errSmtp = notifiers.SendSMTPMailSystem(
-		CONFIG.Configuration.SmtpDisable,
-		CONFIG.Configuration.SmtpUsername,
-		CONFIG.Configuration.SmtpPassword,
-		CONFIG.Configuration.SmtpHost,
-		CONFIG.Configuration.SmtpTo,
-		CONFIG.Configuration.SmtpFrom,
-		CONFIG.Configuration.SmtpPort,
-		status, message,
-	)
-	if errDiscord != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "DISCORD NOTIFICATION", fmt.Sprintf("Unable to send discord webhook notification :: [%s]", errDiscord), "ERROR")
-	} else {
-		utils.ConsoleAndLoggerOutput(LOGGER, "DISCORD NOTIFICATION", "Successfully sent discord webhook notification", "INFO")
+	systemEvent := notifiers.Event{
+		Kind:        notifiers.EventKindSystem,
+		Title:       status,
+		Description: message,
+		Timestamp:   time.Now(),
+	}
+	dispatch(ROUTER.Defaults(), systemEvent)
+}
+
+func main() {
+	// Configuration errors end up in log.Fatal messages and may quote secrets.
+	log.SetOutput(utils.RedactWriter{Writer: os.Stderr})
+	args := os.Args[1:]
+	// Without a command the monitor starts, as it did before there were commands.
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help") {
+		args = append([]string{"run"}, args...)
 	}
-	if errSmtp != nil {
-		utils.ConsoleAndLoggerOutput(LOGGER, "SMTP NOTIFICATION", fmt.Sprintf("Unable to send smtp push notification :: [%s]", errSmtp), "ERROR")
+	var run func(args []string, stdout io.Writer) error
+	if command, ok := COMMANDS[args[0]]; ok {
+		run = func(args []string, stdout io.Writer) error { return command(args[1:]) }
+	} else if api.IsCommand(args) {
+		run = api.RunCLI
+	} else if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(USAGE)
+		return
 	} else {
-		utils.ConsoleAndLoggerOutput(LOGGER, "SMTP NOTIFICATION", "Successfully sent smtp push notification", "INFO")
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", args[0], USAGE)
+		os.Exit(2)
+	}
+	if err := run(args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, utils.Redact(err.Error()))
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(1)
 	}
 }
 
-func main() {
+// runSchema prints the JSON Schema of the configuration file, for editors and CI.
+func runSchema(args []string) error {
+	set := flag.NewFlagSet("schema", flag.ContinueOnError)
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	data, err := utils.SchemaJSON()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runVersion(args []string) error {
+	fmt.Printf("inframon %s %s %s/%s\n", VERSION, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// runDaemon starts the monitor. It only returns if every task stops.
+func runDaemon(args []string) error {
+	setup(args)
+	STARTEDAT = time.Now()
 	utils.ConsoleAndLoggerOutput(LOGGER, "STARTUP", "Starting Inframon", "INFO")
 
 	var wg sync.WaitGroup
 
 	for _, icmpConfig := range CONFIG.ICMP {
-		setHealthStatus(ICMPHEALTH, icmpConfig.Address, true)
+		setHealthStatus(ICMPHEALTH, icmpConfig.ID, true)
 		wg.Add(1)
-		go pingTaskICMP(*ROOTUSERARG, icmpConfig.Address, icmpConfig.Service, icmpConfig.RetryBuffer, icmpConfig.Timeout, icmpConfig.FailureTimeout, icmpConfig.NetworkZone, icmpConfig.InstanceType, &wg)
+		go pingTaskICMP(*ROOTUSERARG, icmpConfig, &wg)
 	}
 
 	for _, httpConfig := range CONFIG.HTTP {
-		setHealthStatus(HTTPHEALTH, httpConfig.Address, true)
+		setHealthStatus(HTTPHEALTH, httpConfig.ID, true)
 		wg.Add(1)
-		go pingTaskHTTP(httpConfig.Address, httpConfig.Service, httpConfig.RetryBuffer, httpConfig.Timeout, httpConfig.FailureTimeout, httpConfig.SkipVerify, httpConfig.NetworkZone, httpConfig.InstanceType, &wg)
+		go pingTaskHTTP(httpConfig, &wg)
 	}
 
 	wg.Add(1)
@@ -342,6 +730,21 @@ func main() {
 		cronScheduledTasks()
 	}()
 
+	wg.Add(1)
+	go escalationTasks()
+
+	wg.Add(1)
+	go scheduleTasks()
+
+	if CONFIG.Configuration.APIEnable {
+		wg.Add(1)
+		go apiTasks()
+	}
+
+	if STATUSLISTENER != nil {
+		go statusTasks()
+	}
+
 	if !CONFIG.Configuration.Stdout {
 		logFileSize := CONFIG.Configuration.LogFileSize
 		logFileSizeConverted, err := utils.ConvertToBytes(logFileSize)
@@ -367,7 +770,330 @@ func main() {
 		<-signalChan
 		sendNotificationSystem("Shutting Down Service", "Shutting Down")
 		utils.ConsoleAndLoggerOutput(LOGGER, "EXIT", "Shutting down inframon system", "INFO")
+		if !QUEUE.Drain(10 * time.Second) {
+			utils.ConsoleAndLoggerOutput(LOGGER, "EXIT", "Notifications still queued at shutdown", "ERROR")
+		}
+		if STATUSLISTENER != nil {
+			STATUSLISTENER.Close()
+		}
 		os.Exit(0)
 	}()
 	wg.Wait()
+	return nil
+}
+
+// loadConfig reads and validates a configuration file for the subcommands, which
+// report problems instead of exiting like the monitor does at startup.
+func loadConfig(path string) (*utils.Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no configuration path provided")
+	}
+	config, err := utils.LoadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+	if err := utils.ValidateICMPConfig(config.ICMP); err != nil {
+		return nil, fmt.Errorf("invalid icmp configuration: %w", err)
+	}
+	if err := utils.ValidateHTTPConfig(config.HTTP); err != nil {
+		return nil, fmt.Errorf("invalid http configuration: %w", err)
+	}
+	if err := utils.ValidateConfiguration(config); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	return config, nil
+}
+
+func runNotifyTest(args []string) error {
+	set := flag.NewFlagSet("notify-test", flag.ContinueOnError)
+	configPath := set.String("config", "", "path/to/file targeting inframon config.yaml file, or a directory of them. Default: Nothing")
+	notifierNames := set.String("notifier", "", "comma separated notifiers to test. Default: every configured notifier")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	templates, err := notifiers.LoadTemplates(config.Configuration.Templates)
+	if err != nil {
+		return fmt.Errorf("invalid notification templates: %w", err)
+	}
+	built, err := alerting.BuildNotifiers(config, templates)
+	if err != nil {
+		return fmt.Errorf("invalid notifier configuration: %w", err)
+	}
+	var names []string
+	if *notifierNames != "" {
+		for _, name := range strings.Split(*notifierNames, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	results, err := alerting.TestNotifiers(built, names)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no notifiers configured")
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NOTIFIER\tTYPE\tEVENT\tRESULT\tERROR")
+	for _, result := range results {
+		event := result.Kind
+		if result.State != "" {
+			event += " " + result.State
+		}
+		outcome, message := "ok", ""
+		switch {
+		case result.Skipped:
+			outcome = "skipped"
+			message = "event kind not supported by notifier"
+		case result.Err != nil:
+			outcome = "failed"
+			message = utils.Redact(result.Err.Error())
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Notifier, result.Type, event, outcome, message)
+	}
+	w.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test notifications failed", failed, len(results))
+	}
+	return nil
+}
+
+func runValidate(args []string) error {
+	set := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := set.String("config", "", "path/to/file targeting inframon config.yaml file, or a directory of them. Default: Nothing")
+	strict := set.Bool("strict", false, "True / False for failing on warnings as well as errors. Default: False")
+	printConfig := set.Bool("print", false, "True / False for printing the resolved configuration when it is valid. Default: False")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		return fmt.Errorf("no configuration path provided")
+	}
+	problems, err := utils.LintConfig(*configPath, checkNotifiers)
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	// With --print, stdout is kept for the configuration so it can be redirected.
+	var report io.Writer = os.Stdout
+	if *printConfig {
+		report = os.Stderr
+	}
+	errorCount, warningCount := 0, 0
+	for _, problem := range problems {
+		if problem.File == "" {
+			problem.File = *configPath
+		}
+		fmt.Fprintf(report, "%s: %s: %s\n", problem.Location(), problem.Severity, utils.Redact(problem.Message))
+		if problem.Severity == utils.ProblemWarning {
+			warningCount++
+		} else {
+			errorCount++
+		}
+	}
+	if errorCount > 0 || (*strict && warningCount > 0) {
+		return fmt.Errorf("%s: %d errors, %d warnings", *configPath, errorCount, warningCount)
+	}
+	if *printConfig {
+		rendered, err := utils.RenderConfig(*configPath)
+		if err != nil {
+			return fmt.Errorf("could not render configuration: %w", err)
+		}
+		fmt.Print(rendered)
+	}
+	fmt.Fprintf(report, "%s: configuration is valid (%d warnings)\n", *configPath, warningCount)
+	return nil
+}
+
+// checkNotifiers loads the templates and builds the notifiers like startup does,
+// which catches templates that do not parse and notifiers that cannot be created.
+func checkNotifiers(config *utils.Config) error {
+	templates, err := notifiers.LoadTemplates(config.Configuration.Templates)
+	if err != nil {
+		return fmt.Errorf("invalid notification templates: %w", err)
+	}
+	if _, err := alerting.BuildNotifiers(config, templates); err != nil {
+		return fmt.Errorf("invalid notifier configuration: %w", err)
+	}
+	return nil
+}
+
+type checkResult struct {
+	ID           string            `json:"id"`
+	Protocol     string            `json:"protocol"`
+	Address      string            `json:"address"`
+	Service      string            `json:"service"`
+	NetworkZone  string            `json:"networkZone"`
+	InstanceType string            `json:"instanceType"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Up           bool              `json:"up"`
+	LatencyMs    int64             `json:"latencyMs,omitempty"`
+	ResponseCode int               `json:"responseCode,omitempty"`
+	Error        string            `json:"error,omitempty"`
+
+	instance notifiers.InstanceStatus
+}
+
+// runCheck probes every selected target once, concurrently, and exits with code 2
+// when any of them is down.
+func runCheck(args []string) error {
+	set := flag.NewFlagSet("check", flag.ContinueOnError)
+	configPath := set.String("config", "", "path/to/file targeting inframon config.yaml file, or a directory of them. Default: Nothing")
+	target := set.String("target", "", "only check the target with this id, address or service. Default: every target")
+	zone := set.String("zone", "", "only check targets in this networkZone. Default: every zone")
+	format := set.String("format", "table", "output format, table or json. Default: table")
+	notify := set.Bool("notify", false, "True / False for sending a notification for every target that is down. Default: False")
+	privileged := set.Bool("root_user", false, "True / False for enabling privileged mode. Default: False")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("format must be table or json")
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	selected := func(t utils.TargetMeta) bool {
+		if *target != "" && *target != t.ID && *target != t.Address && *target != t.Service {
+			return false
+		}
+		return *zone == "" || *zone == t.NetworkZone
+	}
+	var results []*checkResult
+	var wg sync.WaitGroup
+	for _, icmp := range config.ICMP {
+		if !selected(icmp.TargetMeta) {
+			continue
+		}
+		result := &checkResult{instance: alerting.TargetInstance(icmp.Protocol(), icmp.TargetMeta)}
+		results = append(results, result)
+		wg.Add(1)
+		go func(retryBuffer int, failureTimeout int) {
+			defer wg.Done()
+			latency, err := connectors.PingICMP(result.instance.Address, *privileged, retryBuffer, failureTimeout)
+			result.Up = latency != 0
+			result.LatencyMs = latency.Milliseconds()
+			if err != nil && !result.Up {
+				result.Error = err.Error()
+			}
+		}(icmp.RetryBuffer, icmp.FailureTimeout)
+	}
+	for _, http := range config.HTTP {
+		if !selected(http.TargetMeta) {
+			continue
+		}
+		result := &checkResult{instance: alerting.TargetInstance(http.Protocol(), http.TargetMeta)}
+		results = append(results, result)
+		wg.Add(1)
+		go func(skipVerify bool, retryBuffer int, failureTimeout int) {
+			defer wg.Done()
+			start := time.Now()
+			code, err := connectors.PingHTTP(result.instance.Address, result.instance.Service, skipVerify, retryBuffer, failureTimeout)
+			result.Up = err == nil && code != 0
+			result.ResponseCode = code
+			if result.Up {
+				result.LatencyMs = time.Since(start).Milliseconds()
+			} else if err != nil {
+				result.Error = err.Error()
+			}
+		}(http.SkipVerify, http.RetryBuffer, http.FailureTimeout)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no targets match")
+	}
+	wg.Wait()
+
+	down := 0
+	for _, result := range results {
+		result.ID = result.instance.ID
+		result.Protocol = result.instance.Protocol
+		result.Address = result.instance.Address
+		result.Service = result.instance.Service
+		result.NetworkZone = result.instance.NetworkZone
+		result.InstanceType = result.instance.InstanceType
+		result.Labels = result.instance.Labels
+		result.instance.Status = result.Up
+		if !result.Up {
+			down++
+		}
+	}
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PROTOCOL\tADDRESS\tSERVICE\tNETWORKZONE\tSTATUS\tLATENCY\tERROR")
+		for _, result := range results {
+			status, latency := "UP", fmt.Sprintf("%dms", result.LatencyMs)
+			if !result.Up {
+				status, latency = "DOWN", "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", result.Protocol, result.Address, result.Service, result.NetworkZone, status, latency, result.Error)
+		}
+		w.Flush()
+	}
+
+	if *notify && down > 0 {
+		if err := notifyCheckFailures(config, results); err != nil {
+			return err
+		}
+	}
+	if down > 0 {
+		return &exitCodeError{code: 2, err: fmt.Errorf("%d of %d targets down", down, len(results))}
+	}
+	return nil
+}
+
+// notifyCheckFailures sends an outage notification for every target that is down
+// to the notifiers its route selects. Recoveries are not sent because a single
+// check does not know the previous state.
+func notifyCheckFailures(config *utils.Config, results []*checkResult) error {
+	templates, err := notifiers.LoadTemplates(config.Configuration.Templates)
+	if err != nil {
+		return fmt.Errorf("invalid notification templates: %w", err)
+	}
+	built, err := alerting.BuildNotifiers(config, templates)
+	if err != nil {
+		return fmt.Errorf("invalid notifier configuration: %w", err)
+	}
+	router := alerting.NewRouter(config)
+	var errs []error
+	for _, result := range results {
+		if result.Up {
+			continue
+		}
+		event := notifiers.Event{
+			Kind:        notifiers.EventKindTransition,
+			Title:       "Connection Interrupted",
+			Description: fmt.Sprintf("%s Monitor", result.Protocol),
+			State:       notifiers.StateDown,
+			Target:      result.instance,
+			Error:       result.Error,
+			Timestamp:   time.Now(),
+		}
+		for _, name := range router.Route(result.instance) {
+			notifier, ok := built[name]
+			if !ok {
+				continue
+			}
+			if err := notifier.Send(event); err != nil && !errors.Is(err, notifiers.ErrEventNotSupported) {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", name, result.Address, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send notifications: %w", errors.Join(errs...))
+	}
+	return nil
 }
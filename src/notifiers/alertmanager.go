@@ -0,0 +1,59 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlertmanagerAlertName  = "InframonTargetDown"
+	alertmanagerAlertsPath = "/api/v2/alerts"
+)
+
+type AlertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func SendToAlertmanager(baseURL string, title string, description string, instance InstanceStatus, startsAt time.Time) error {
+	if baseURL == "" {
+		return fmt.Errorf("alertmanager url is empty")
+	}
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+
+	alert := AlertmanagerAlert{
+		Labels: map[string]string{
+			"alertname":    AlertmanagerAlertName,
+			"service":      instance.Service,
+			"address":      instance.Address,
+			"networkZone":  instance.NetworkZone,
+			"instanceType": instance.InstanceType,
+			"protocol":     instance.Protocol,
+		},
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s :: %s :: %s (%s)", title, description, instance.Service, instance.Address),
+			"description": fmt.Sprintf("%s target %s (%s) in networkZone %s is unreachable", instance.Protocol, instance.Service, instance.Address, instance.NetworkZone),
+		},
+		StartsAt: startsAt.UTC().Format(time.RFC3339),
+	}
+	for name, value := range instance.Labels {
+		alert.Labels[name] = value
+	}
+	if instance.Status {
+		alert.EndsAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	payload, err := json.Marshal([]AlertmanagerAlert{alert})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	url := strings.TrimSuffix(baseURL, "/") + alertmanagerAlertsPath
+	return sendJSONRequest("POST", url, nil, payload)
+}
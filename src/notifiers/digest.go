@@ -0,0 +1,137 @@
+package notifiers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Discord rejects messages above these limits.
+const (
+	discordMaxEmbeds      = 10
+	discordMaxFields      = 25
+	discordMaxMessageSize = 6000
+)
+
+type DigestGroup struct {
+	NetworkZone string  `json:"networkZone"`
+	Events      []Event `json:"events"`
+}
+
+type DiscordDigestPage struct {
+	Title       string
+	Description string
+	NetworkZone string
+	Page        int
+	Pages       int
+	Events      []Event
+	Omitted     int
+	Timestamp   time.Time
+}
+
+// SupportsDigest reports whether n can send several transitions as one message.
+// Incident APIs such as PagerDuty need one event per target and are never batched.
+func SupportsDigest(n Notifier) bool {
+	switch n.Type() {
+	case TypeDiscord, TypeSMTP, TypeMatrix, TypeWebhook:
+		return true
+	}
+	return false
+}
+
+// NewDigestEvent combines transitions into one digest event. Only the first
+// maxEvents are kept; the rest are counted in Omitted.
+func NewDigestEvent(events []Event, maxEvents int) Event {
+	down := 0
+	for _, event := range events {
+		if event.State == StateDown {
+			down++
+		}
+	}
+	digest := Event{
+		Kind:        EventKindDigest,
+		Title:       fmt.Sprintf("%d Targets Changed State", len(events)),
+		Description: fmt.Sprintf("%d down, %d up", down, len(events)-down),
+		Timestamp:   time.Now(),
+		Events:      events,
+	}
+	if maxEvents > 0 && len(events) > maxEvents {
+		digest.Events = events[:maxEvents]
+		digest.Omitted = len(events) - maxEvents
+	}
+	return digest
+}
+
+func groupByZone(events []Event) []DigestGroup {
+	var groups []DigestGroup
+	index := make(map[string]int)
+	for _, event := range events {
+		i, ok := index[event.Target.NetworkZone]
+		if !ok {
+			i = len(groups)
+			index[event.Target.NetworkZone] = i
+			groups = append(groups, DigestGroup{NetworkZone: event.Target.NetworkZone})
+		}
+		groups[i].Events = append(groups[i].Events, event)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].NetworkZone < groups[j].NetworkZone })
+	return groups
+}
+
+// RenderDiscordDigest renders one embed per network zone, split into pages of at
+// most 25 transitions, and packs the embeds into as many messages as Discord needs.
+func (t *Templates) RenderDiscordDigest(event Event) ([]Message, error) {
+	var pages []DiscordDigestPage
+	for _, group := range groupByZone(event.Events) {
+		count := (len(group.Events) + discordMaxFields - 1) / discordMaxFields
+		for i := 0; i < count; i++ {
+			end := (i + 1) * discordMaxFields
+			if end > len(group.Events) {
+				end = len(group.Events)
+			}
+			pages = append(pages, DiscordDigestPage{
+				Title:       event.Title,
+				Description: event.Description,
+				NetworkZone: group.NetworkZone,
+				Page:        i + 1,
+				Pages:       count,
+				Events:      group.Events[i*discordMaxFields : end],
+				Timestamp:   event.Timestamp,
+			})
+		}
+	}
+	if len(pages) > 0 {
+		pages[len(pages)-1].Omitted = event.Omitted
+	}
+
+	var messages []Message
+	var current Message
+	size := 0
+	for _, page := range pages {
+		var buf bytes.Buffer
+		if err := t.text["discordDigest"].Execute(&buf, page); err != nil {
+			return nil, fmt.Errorf("failed to render template discordDigest: %w", err)
+		}
+		var embed DiscordEmbed
+		if err := json.Unmarshal(buf.Bytes(), &embed); err != nil {
+			return nil, fmt.Errorf("template discordDigest did not render a valid discord embed: %w", err)
+		}
+		embedSize := len(embed.Title) + len(embed.Description)
+		for _, field := range embed.Fields {
+			embedSize += len(field.Name) + len(field.Value)
+		}
+		if len(current.Embeds) == discordMaxEmbeds || (len(current.Embeds) > 0 && size+embedSize > discordMaxMessageSize) {
+			messages = append(messages, current)
+			current = Message{}
+			size = 0
+		}
+		current.Embeds = append(current.Embeds, embed)
+		size += embedSize
+	}
+	if len(current.Embeds) > 0 {
+		messages = append(messages, current)
+	}
+	return messages, nil
+}
@@ -0,0 +1,350 @@
+package notifiers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discordMaxInlineWait is the longest a send waits for a rate limit bucket to
+// reset before giving the notification back to the queue.
+const discordMaxInlineWait = 10 * time.Second
+
+type DiscordConfig struct {
+	WebhookURL     string
+	ThreadID       string
+	Username       string
+	AvatarURL      string
+	Mentions       map[string][]string
+	EditOnRecovery bool
+}
+
+type DiscordAllowedMentions struct {
+	Parse []string `json:"parse"`
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+type discordMessageResponse struct {
+	ID string `json:"id"`
+}
+
+type discordRateLimitResponse struct {
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+type discordBucket struct {
+	remaining int
+	resetAt   time.Time
+}
+
+// discordRateLimits tracks the buckets Discord reports in its X-RateLimit headers.
+// Routes are mapped to buckets because several routes can share one.
+type discordRateLimits struct {
+	mu          sync.Mutex
+	routes      map[string]string
+	buckets     map[string]*discordBucket
+	globalReset time.Time
+}
+
+var discordLimits = &discordRateLimits{routes: make(map[string]string), buckets: make(map[string]*discordBucket)}
+
+func (l *discordRateLimits) wait(route string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	wait := l.globalReset.Sub(now)
+	if bucket, ok := l.buckets[l.bucketID(route)]; ok && bucket.remaining <= 0 {
+		if untilReset := bucket.resetAt.Sub(now); untilReset > wait {
+			wait = untilReset
+		}
+	}
+	return wait
+}
+
+func (l *discordRateLimits) bucketID(route string) string {
+	if id, ok := l.routes[route]; ok {
+		return id
+	}
+	return route
+}
+
+func (l *discordRateLimits) update(route string, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := header.Get("X-RateLimit-Bucket")
+	if id == "" {
+		id = route
+	}
+	l.routes[route] = id
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	bucket := &discordBucket{remaining: remaining}
+	if resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		bucket.resetAt = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+	}
+	l.buckets[id] = bucket
+}
+
+func (l *discordRateLimits) limited(route string, after time.Duration, global bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resetAt := time.Now().Add(after)
+	if global {
+		l.globalReset = resetAt
+		return
+	}
+	l.buckets[l.bucketID(route)] = &discordBucket{remaining: 0, resetAt: resetAt}
+}
+
+type DiscordNotifier struct {
+	name           string
+	config         DiscordConfig
+	templates      *Templates
+	summaryDisable bool
+	mu             sync.Mutex
+	messages       map[string]string
+	// digest and digestPages record how many pages of the last digest were
+	// posted, so a retry of that digest starts at the page that failed.
+	digest      string
+	digestPages int
+}
+
+func NewDiscordNotifier(name string, config DiscordConfig, templates *Templates, summaryDisable bool) *DiscordNotifier {
+	return &DiscordNotifier{name: name, config: config, templates: templates, summaryDisable: summaryDisable, messages: make(map[string]string)}
+}
+
+func (n *DiscordNotifier) Name() string { return n.name }
+func (n *DiscordNotifier) Type() string { return TypeDiscord }
+
+func (n *DiscordNotifier) Send(event Event) error {
+	switch event.Kind {
+	case EventKindTransition:
+		return n.sendTransition(event)
+	case EventKindSummary:
+		if n.summaryDisable {
+			return ErrEventNotSupported
+		}
+		return n.sendEmbed(event)
+	case EventKindDigest:
+		messages, err := n.templates.RenderDiscordDigest(event)
+		if err != nil {
+			return err
+		}
+		mentions := n.mentions(event.Events...)
+		key := strconv.FormatInt(event.Timestamp.UnixNano(), 10) + "/" + event.Title
+		n.mu.Lock()
+		if n.digest != key {
+			n.digest, n.digestPages = key, 0
+		}
+		sent := n.digestPages
+		n.mu.Unlock()
+		for i := sent; i < len(messages); i++ {
+			if i == 0 {
+				messages[i].Content = mentions
+			}
+			if _, err := n.post(messages[i]); err != nil {
+				return err
+			}
+			n.mu.Lock()
+			n.digestPages = i + 1
+			n.mu.Unlock()
+		}
+		return nil
+	default:
+		return n.sendEmbed(event)
+	}
+}
+
+func (n *DiscordNotifier) sendEmbed(event Event) error {
+	embed, err := n.templates.RenderDiscord(event)
+	if err != nil {
+		return err
+	}
+	_, err = n.post(Message{Embeds: []DiscordEmbed{embed}})
+	return err
+}
+
+// sendTransition remembers the message of every new outage so that, with
+// EditOnRecovery, the original alert is edited to show the recovery as well.
+func (n *DiscordNotifier) sendTransition(event Event) error {
+	embed, err := n.templates.RenderDiscord(event)
+	if err != nil {
+		return err
+	}
+	key := DedupKey(event.Target)
+	message := Message{Embeds: []DiscordEmbed{embed}}
+
+	if event.State == StateUp {
+		n.mu.Lock()
+		id, ok := n.messages[key]
+		n.mu.Unlock()
+		if n.config.EditOnRecovery && ok {
+			if err := n.edit(id, message); err != nil {
+				return fmt.Errorf("failed to edit original alert: %w", err)
+			}
+		}
+		if _, err := n.post(message); err != nil {
+			return err
+		}
+		n.mu.Lock()
+		delete(n.messages, key)
+		n.mu.Unlock()
+		return nil
+	}
+
+	message.Content = n.mentions(event)
+	id, err := n.post(message)
+	if err != nil {
+		return err
+	}
+	if n.config.EditOnRecovery && event.Escalation == 0 && id != "" {
+		n.mu.Lock()
+		n.messages[key] = id
+		n.mu.Unlock()
+	}
+	return nil
+}
+
+// mentions returns the configured mentions for the severities of the targets that
+// went down, most severe first, without duplicates.
+func (n *DiscordNotifier) mentions(events ...Event) string {
+	var mentions []string
+	for _, severity := range []string{"critical", "warning", "info"} {
+		for _, event := range events {
+			target := event.Target.Severity
+			if target == "" {
+				target = "critical"
+			}
+			if event.State != StateDown || target != severity {
+				continue
+			}
+			for _, mention := range n.config.Mentions[severity] {
+				if !containsString(mentions, mention) {
+					mentions = append(mentions, mention)
+				}
+			}
+			break
+		}
+	}
+	return strings.Join(mentions, " ")
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMentions only lets the configured mentions ping anyone, so a target name
+// or error message containing @everyone stays harmless.
+func allowedMentions(content string) *DiscordAllowedMentions {
+	allowed := &DiscordAllowedMentions{Parse: []string{}}
+	for _, mention := range strings.Fields(content) {
+		switch {
+		case mention == "@everyone" || mention == "@here":
+			if !containsString(allowed.Parse, "everyone") {
+				allowed.Parse = append(allowed.Parse, "everyone")
+			}
+		case strings.HasPrefix(mention, "<@&"):
+			allowed.Roles = append(allowed.Roles, strings.TrimSuffix(strings.TrimPrefix(mention, "<@&"), ">"))
+		case strings.HasPrefix(mention, "<@"):
+			allowed.Users = append(allowed.Users, strings.TrimSuffix(strings.TrimPrefix(mention, "<@"), ">"))
+		}
+	}
+	return allowed
+}
+
+func (n *DiscordNotifier) post(message Message) (string, error) {
+	message.Username = n.config.Username
+	message.AvatarURL = n.config.AvatarURL
+	message.AllowedMentions = allowedMentions(message.Content)
+	query := url.Values{"wait": {"true"}}
+	if n.config.ThreadID != "" {
+		query.Set("thread_id", n.config.ThreadID)
+	}
+	return sendDiscordRequest(http.MethodPost, n.config.WebhookURL, query, message)
+}
+
+func (n *DiscordNotifier) edit(id string, message Message) error {
+	message.AllowedMentions = &DiscordAllowedMentions{Parse: []string{}}
+	query := url.Values{}
+	if n.config.ThreadID != "" {
+		query.Set("thread_id", n.config.ThreadID)
+	}
+	_, err := sendDiscordRequest(http.MethodPatch, strings.TrimSuffix(n.config.WebhookURL, "/")+"/messages/"+url.PathEscape(id), query, message)
+	return err
+}
+
+// sendDiscordRequest waits out a known rate limit before sending and returns the id
+// of the message Discord created or edited.
+func sendDiscordRequest(method string, endpoint string, query url.Values, message Message) (string, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message: %w", err)
+	}
+	requestURL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse webhook url: %w", err)
+	}
+	values := requestURL.Query()
+	for k, v := range query {
+		values[k] = v
+	}
+	requestURL.RawQuery = values.Encode()
+
+	route := method + " " + endpoint
+	if method == http.MethodPatch {
+		route = method + " " + endpoint[:strings.LastIndex(endpoint, "/")]
+	}
+	if wait := discordLimits.wait(route); wait > 0 {
+		if wait > discordMaxInlineWait {
+			return "", &RetryAfterError{After: wait, Err: fmt.Errorf("rate limited")}
+		}
+		time.Sleep(wait)
+	}
+
+	req, err := http.NewRequest(method, requestURL.String(), bytes.NewBuffer(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	discordLimits.update(route, resp.Header)
+
+	if resp.StatusCode == StatusTooManyRequests {
+		var limit discordRateLimitResponse
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&limit)
+		retryErr := newRetryAfterError(resp)
+		if after := time.Duration(limit.RetryAfter * float64(time.Second)); after > retryErr.After {
+			retryErr.After = after
+		}
+		discordLimits.limited(route, retryErr.After, limit.Global || resp.Header.Get("X-RateLimit-Global") == "true")
+		return "", retryErr
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	var created discordMessageResponse
+	if resp.StatusCode == http.StatusOK {
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&created)
+	}
+	return created.ID, nil
+}
@@ -0,0 +1,141 @@
+package notifiers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const matrixSendPath = "/_matrix/client/v3/rooms/%s/send/m.room.message/%s"
+
+type MatrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+func SendToMatrix(homeserverURL string, accessToken string, roomID string, event Event) error {
+	if homeserverURL == "" || accessToken == "" || roomID == "" {
+		return fmt.Errorf("matrix homeserver url, access token and room id are required")
+	}
+
+	plain, formatted := formatMatrixEvent(event)
+	message := MatrixMessage{
+		MsgType:       "m.text",
+		Body:          plain,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: formatted,
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// The homeserver drops messages whose transaction id it has already seen, so
+	// a retry of a message whose response was lost is not posted twice.
+	txnID := matrixTxnID(event)
+	requestURL := strings.TrimSuffix(homeserverURL, "/") + fmt.Sprintf(matrixSendPath, url.PathEscape(roomID), url.PathEscape(txnID))
+	headers := map[string]string{"Authorization": "Bearer " + accessToken}
+	return sendJSONRequest("PUT", requestURL, headers, payload)
+}
+
+// matrixTxnID derives the transaction id from the event rather than the attempt,
+// so it stays the same when the queue sends the event again.
+func matrixTxnID(event Event) string {
+	key := strings.Join([]string{
+		event.Kind,
+		event.Target.ID,
+		strconv.FormatInt(event.Timestamp.UnixNano(), 10),
+		strconv.Itoa(event.Escalation),
+		event.Title,
+		event.Description,
+	}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return "inframon-" + hex.EncodeToString(sum[:16])
+}
+
+func formatMatrixEvent(event Event) (string, string) {
+	now := event.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	esc := html.EscapeString
+
+	switch event.Kind {
+	case EventKindTransition:
+		color := "#00a600"
+		if !event.Target.Status {
+			color = "#b70000"
+		}
+		plain := fmt.Sprintf("Inframon: %s :: %s :: %s (%s) NetworkZone: %s InstanceType: %s Date: %s Time: %s",
+			event.Title, event.Description, event.Target.Service, event.Target.Address, event.Target.NetworkZone, event.Target.InstanceType, now.Format("2006-01-02"), now.Format("15:04:05"))
+		formatted := fmt.Sprintf(`<h4><font color="%s">%s</font></h4><p>%s</p><ul><li><strong>Address:</strong> %s</li><li><strong>Service:</strong> %s</li><li><strong>NetworkZone:</strong> %s</li><li><strong>InstanceType:</strong> %s</li><li><strong>Date:</strong> %s</li><li><strong>Time:</strong> %s</li></ul>`,
+			color, esc(event.Title), esc(event.Description), esc(event.Target.Address), esc(event.Target.Service), esc(event.Target.NetworkZone), esc(event.Target.InstanceType), now.Format("2006-01-02"), now.Format("15:04:05"))
+		if len(event.Target.Labels) > 0 {
+			labels := FormatLabels(event.Target.Labels)
+			plain += " Labels: " + labels
+			formatted = strings.TrimSuffix(formatted, "</ul>") + fmt.Sprintf("<li><strong>Labels:</strong> %s</li></ul>", esc(labels))
+		}
+		if event.Error != "" {
+			plain += " Error: " + event.Error
+			formatted = strings.TrimSuffix(formatted, "</ul>") + fmt.Sprintf("<li><strong>Error:</strong> %s</li></ul>", esc(event.Error))
+		}
+		if event.Acknowledgement != nil {
+			acknowledged := describeAcknowledgement(event.Acknowledgement)
+			plain += " Acknowledged: " + acknowledged
+			formatted = strings.TrimSuffix(formatted, "</ul>") + fmt.Sprintf("<li><strong>Acknowledged:</strong> %s</li></ul>", esc(acknowledged))
+		}
+		return plain, formatted
+	case EventKindDigest:
+		plain := fmt.Sprintf("Inframon: %s :: %s Date: %s Time: %s", event.Title, event.Description, now.Format("2006-01-02"), now.Format("15:04:05"))
+		formatted := fmt.Sprintf(`<h4><font color="#ffa500">%s</font></h4><p>%s</p>`, esc(event.Title), esc(event.Description))
+		for _, group := range groupByZone(event.Events) {
+			var items []string
+			plain += "\n" + group.NetworkZone + ":"
+			for _, e := range group.Events {
+				line := fmt.Sprintf("%s %s %s: %s (%s)", e.State, e.Timestamp.Format("15:04:05"), e.Target.Protocol, e.Target.Address, e.Target.Service)
+				plain += "\n" + line
+				items = append(items, esc(line))
+			}
+			formatted += fmt.Sprintf("<p><strong>%s</strong></p><ul><li>%s</li></ul>", esc(group.NetworkZone), strings.Join(items, "</li><li>"))
+		}
+		if event.Omitted > 0 {
+			plain += fmt.Sprintf("\n%d more transitions were left out of this digest", event.Omitted)
+			formatted += fmt.Sprintf("<p>%d more transitions were left out of this digest</p>", event.Omitted)
+		}
+		return plain, formatted
+	case EventKindSummary:
+		var failed []string
+		for _, status := range event.Statuses {
+			if !status.Status {
+				failed = append(failed, fmt.Sprintf("%s: %s (%s)", status.Protocol, status.Address, status.Service))
+			}
+		}
+		if len(failed) == 0 {
+			plain := fmt.Sprintf("Inframon: Scheduled Report :: All Pass Date: %s Time: %s", now.Format("2006-01-02"), now.Format("15:04:05"))
+			formatted := fmt.Sprintf(`<h4><font color="#00a600">Scheduled Report</font></h4><p><strong>Status:</strong> All Pass</p><ul><li><strong>Date:</strong> %s</li><li><strong>Time:</strong> %s</li></ul>`,
+				now.Format("2006-01-02"), now.Format("15:04:05"))
+			return plain, formatted
+		}
+		escaped := make([]string, len(failed))
+		for i, f := range failed {
+			escaped[i] = esc(f)
+		}
+		plain := fmt.Sprintf("Inframon: Scheduled Report :: Failing Services:\n%s", strings.Join(failed, "\n"))
+		formatted := fmt.Sprintf(`<h4><font color="#b70000">Scheduled Report</font></h4><p><strong>Failing Services:</strong></p><ul><li>%s</li></ul><p>%s %s</p>`,
+			strings.Join(escaped, "</li><li>"), now.Format("2006-01-02"), now.Format("15:04:05"))
+		return plain, formatted
+	default:
+		plain := fmt.Sprintf("Inframon: %s :: %s Date: %s Time: %s", event.Title, event.Description, now.Format("2006-01-02"), now.Format("15:04:05"))
+		formatted := fmt.Sprintf(`<h4><font color="#4682B4">%s</font></h4><p>%s</p><ul><li><strong>Date:</strong> %s</li><li><strong>Time:</strong> %s</li></ul>`,
+			esc(event.Title), esc(event.Description), now.Format("2006-01-02"), now.Format("15:04:05"))
+		return plain, formatted
+	}
+}
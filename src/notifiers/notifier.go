@@ -0,0 +1,145 @@
+package notifiers
+
+import "errors"
+
+const (
+	TypeDiscord      = "discord"
+	TypeSMTP         = "smtp"
+	TypePagerDuty    = "pagerduty"
+	TypeAlertmanager = "alertmanager"
+	TypeOpsgenie     = "opsgenie"
+	TypeWebhook      = "webhook"
+	TypeMatrix       = "matrix"
+)
+
+var ErrEventNotSupported = errors.New("event kind not supported by notifier")
+
+// Notifier delivers events to one destination. Send makes a single attempt;
+// retries are left to the caller, see alerting.Queue.
+type Notifier interface {
+	Name() string
+	Type() string
+	Send(event Event) error
+}
+
+type SMTPNotifier struct {
+	name           string
+	config         SMTPConfig
+	templates      *Templates
+	summaryDisable bool
+}
+
+func NewSMTPNotifier(name string, config SMTPConfig, templates *Templates, summaryDisable bool) *SMTPNotifier {
+	return &SMTPNotifier{name: name, config: config, templates: templates, summaryDisable: summaryDisable}
+}
+
+func (n *SMTPNotifier) Name() string { return n.name }
+func (n *SMTPNotifier) Type() string { return TypeSMTP }
+
+func (n *SMTPNotifier) Send(event Event) error {
+	if event.Kind == EventKindSummary && n.summaryDisable {
+		return ErrEventNotSupported
+	}
+	return SendSMTPMail(n.config, n.templates, event)
+}
+
+type PagerDutyNotifier struct {
+	name        string
+	baseURL     string
+	routingKey  string
+	routingKeys map[string]string
+}
+
+// NewPagerDutyNotifier takes per-target routing keys indexed by target id; targets
+// without one fall back to routingKey.
+func NewPagerDutyNotifier(name string, baseURL string, routingKey string, routingKeys map[string]string) *PagerDutyNotifier {
+	return &PagerDutyNotifier{name: name, baseURL: baseURL, routingKey: routingKey, routingKeys: routingKeys}
+}
+
+func (n *PagerDutyNotifier) Name() string { return n.name }
+func (n *PagerDutyNotifier) Type() string { return TypePagerDuty }
+
+func (n *PagerDutyNotifier) Send(event Event) error {
+	if event.Kind != EventKindTransition {
+		return ErrEventNotSupported
+	}
+	routingKey := n.routingKeys[event.Target.ID]
+	if routingKey == "" {
+		routingKey = n.routingKey
+	}
+	return SendToPagerDuty(n.baseURL, routingKey, event.Title, event.Description, event.Target)
+}
+
+type AlertmanagerNotifier struct {
+	name    string
+	baseURL string
+}
+
+func NewAlertmanagerNotifier(name string, baseURL string) *AlertmanagerNotifier {
+	return &AlertmanagerNotifier{name: name, baseURL: baseURL}
+}
+
+func (n *AlertmanagerNotifier) Name() string { return n.name }
+func (n *AlertmanagerNotifier) Type() string { return TypeAlertmanager }
+
+func (n *AlertmanagerNotifier) Send(event Event) error {
+	if event.Kind != EventKindTransition && event.Kind != EventKindRefresh {
+		return ErrEventNotSupported
+	}
+	return SendToAlertmanager(n.baseURL, event.Title, event.Description, event.Target, event.Since)
+}
+
+type OpsgenieNotifier struct {
+	name     string
+	baseURL  string
+	apiKey   string
+	priority string
+}
+
+func NewOpsgenieNotifier(name string, baseURL string, apiKey string, priority string) *OpsgenieNotifier {
+	return &OpsgenieNotifier{name: name, baseURL: baseURL, apiKey: apiKey, priority: priority}
+}
+
+func (n *OpsgenieNotifier) Name() string { return n.name }
+func (n *OpsgenieNotifier) Type() string { return TypeOpsgenie }
+
+func (n *OpsgenieNotifier) Send(event Event) error {
+	if event.Kind != EventKindTransition {
+		return ErrEventNotSupported
+	}
+	return SendToOpsgenie(n.baseURL, n.apiKey, n.priority, event.Title, event.Description, event.Target)
+}
+
+type WebhookNotifier struct {
+	name     string
+	template *WebhookTemplate
+}
+
+func NewWebhookNotifier(name string, template *WebhookTemplate) *WebhookNotifier {
+	return &WebhookNotifier{name: name, template: template}
+}
+
+func (n *WebhookNotifier) Name() string { return n.name }
+func (n *WebhookNotifier) Type() string { return TypeWebhook }
+
+func (n *WebhookNotifier) Send(event Event) error {
+	return n.template.Send(event)
+}
+
+type MatrixNotifier struct {
+	name          string
+	homeserverURL string
+	accessToken   string
+	roomID        string
+}
+
+func NewMatrixNotifier(name string, homeserverURL string, accessToken string, roomID string) *MatrixNotifier {
+	return &MatrixNotifier{name: name, homeserverURL: homeserverURL, accessToken: accessToken, roomID: roomID}
+}
+
+func (n *MatrixNotifier) Name() string { return n.name }
+func (n *MatrixNotifier) Type() string { return TypeMatrix }
+
+func (n *MatrixNotifier) Send(event Event) error {
+	return SendToMatrix(n.homeserverURL, n.accessToken, n.roomID, event)
+}
@@ -2,12 +2,15 @@ package notifiers
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/smtp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/somememoryspace/inframon/src/utils"
 )
 
 const (
@@ -15,8 +18,11 @@ const (
 )
 
 type Message struct {
-	Content string         `json:"content,omitempty"`
-	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
+	Content         string                  `json:"content,omitempty"`
+	Username        string                  `json:"username,omitempty"`
+	AvatarURL       string                  `json:"avatar_url,omitempty"`
+	Embeds          []DiscordEmbed          `json:"embeds,omitempty"`
+	AllowedMentions *DiscordAllowedMentions `json:"allowed_mentions,omitempty"`
 }
 
 type DiscordEmbed struct {
@@ -32,560 +38,145 @@ type DiscordField struct {
 	Inline bool   `json:"inline,omitempty"`
 }
 
+const (
+	EventKindTransition = "transition"
+	EventKindSystem     = "system"
+	EventKindSummary    = "summary"
+	EventKindDigest     = "digest"
+	// EventKindRefresh re-posts the firing alert of a target that is still down
+	// to Alertmanager, which expires alerts that are not re-sent.
+	EventKindRefresh = "refresh"
+
+	StateUp   = "UP"
+	StateDown = "DOWN"
+)
+
 type InstanceStatus struct {
-	Address      string
-	Service      string
-	NetworkZone  string
-	InstanceType string
-	Protocol     string
-	Status       bool
+	ID           string            `json:"id,omitempty"`
+	Address      string            `json:"address"`
+	Service      string            `json:"service"`
+	NetworkZone  string            `json:"networkZone"`
+	InstanceType string            `json:"instanceType"`
+	Protocol     string            `json:"protocol"`
+	Status       bool              `json:"status"`
+	RunbookURL   string            `json:"runbookUrl,omitempty"`
+	Severity     string            `json:"severity,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
 }
 
-func SendToDiscordWebhook(discordWebhookDisable bool, webhookURL string, title string, description string, color int, address string, service string, networkZone string, instanceType string, retryCount int, rateLimitResetTime time.Duration, maxRetries int) error {
-	if discordWebhookDisable {
-		return fmt.Errorf("discord webhook notifications disabled")
+// FormatLabels writes labels as name=value pairs sorted by name.
+func FormatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
 	}
-	now := time.Now()
-	embed := DiscordEmbed{
-		Title:       title,
-		Description: description,
-		Color:       color,
-		Fields: []DiscordField{
-			{Name: "Address", Value: address, Inline: true},
-			{Name: "Service", Value: service, Inline: true},
-			{Name: "Date", Value: now.Format("2006-01-02"), Inline: true},
-			{Name: "Time", Value: now.Format("15:04:05"), Inline: true},
-			{Name: "NetworkZone", Value: networkZone, Inline: true},
-			{Name: "InstanceType", Value: instanceType, Inline: true},
-		},
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + labels[name]
 	}
-	message := Message{Embeds: []DiscordEmbed{embed}}
-	payload, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-	return sendWithRetries(webhookURL, payload, retryCount, rateLimitResetTime, maxRetries)
+	return strings.Join(pairs, ", ")
 }
 
-func SendToDiscordWebhookSystem(discordWebhookDisable bool, webhookURL string, title string, description string, color int, retryCount int, rateLimitResetTime time.Duration, maxRetries int) error {
-	if discordWebhookDisable {
-		return fmt.Errorf("discord webhook notifications disabled")
-	}
-	now := time.Now()
-	embed := DiscordEmbed{
-		Title:       title,
-		Description: description,
-		Color:       color,
-		Fields: []DiscordField{
-			{Name: "Date", Value: now.Format("2006-01-02"), Inline: true},
-			{Name: "Time", Value: now.Format("15:04:05"), Inline: true},
-		},
-	}
-	message := Message{Embeds: []DiscordEmbed{embed}}
-	payload, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-	return sendWithRetries(webhookURL, payload, retryCount, rateLimitResetTime, maxRetries)
+type Acknowledgement struct {
+	Author  string    `json:"author"`
+	Comment string    `json:"comment,omitempty"`
+	Time    time.Time `json:"time"`
 }
 
-func sendWithRetries(webhookURL string, payload []byte, retryCount int, rateLimitResetTime time.Duration, maxRetries int) error {
-	for i := 0; i <= maxRetries; i++ {
-		err := sendDiscordRequest(webhookURL, payload)
-		if err == nil {
-			return nil
-		}
-		if i < maxRetries {
-			time.Sleep(rateLimitResetTime)
-		}
-	}
-	return fmt.Errorf("failed to send request after %d retries", maxRetries)
+type Event struct {
+	Kind        string           `json:"kind"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	State       string           `json:"state,omitempty"`
+	Target      InstanceStatus   `json:"target"`
+	Latency     time.Duration    `json:"latency,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Timestamp   time.Time        `json:"timestamp"`
+	Since       time.Time        `json:"since,omitempty"`
+	Statuses    []InstanceStatus `json:"statuses,omitempty"`
+	Escalation  int              `json:"escalation,omitempty"`
+	Events      []Event          `json:"events,omitempty"`
+	Omitted     int              `json:"omitted,omitempty"`
+	// Acknowledgement is set on events about an outage someone has acknowledged.
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"`
 }
 
-func sendDiscordRequest(webhookURL string, payload []byte) error {
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+// DedupKey identifies the alerts of a target in external systems, such as the
+// PagerDuty dedup key or the Opsgenie alias. Targets without an id of their own
+// keep the key they had before targets had ids, so their open incidents carry on.
+func DedupKey(target InstanceStatus) string {
+	if target.ID == "" || target.ID == utils.TargetID(target.Protocol, target.Address) {
+		return AddressKey(target)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == StatusTooManyRequests {
-		return fmt.Errorf("rate limited, retrying")
-	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("unexpected response status: %s", resp.Status)
-	}
-	return nil
+	return "inframon/" + target.ID
 }
 
-func SendStatusSummaryToDiscord(healthCronWebhookDisable bool, discordWebhookDisable bool, webhookURL string, icmpStatuses []InstanceStatus, httpStatuses []InstanceStatus, retryCount int, rateLimitResetTime time.Duration, maxRetries int) error {
-	if discordWebhookDisable {
-		return fmt.Errorf("discord webhook notifications disabled")
-	}
-	if healthCronWebhookDisable {
-		return fmt.Errorf("healthConWebhookDisable webhook notifications disabled")
-	}
-	var failedServices []string
-	for _, status := range icmpStatuses {
-		if !status.Status {
-			failedServices = append(failedServices, fmt.Sprintf("ICMP: %s (%s)", status.Address, status.Service))
-		}
-	}
-	for _, status := range httpStatuses {
-		if !status.Status {
-			failedServices = append(failedServices, fmt.Sprintf("HTTP: %s (%s)", status.Address, status.Service))
-		}
-	}
-	now := time.Now()
-
-	var embed DiscordEmbed
-	if len(failedServices) == 0 {
-		embed = DiscordEmbed{
-			Title: "Scheduled Report",
-			Color: 0x00FF00,
-			Fields: []DiscordField{
-				{
-					Name:   "Status",
-					Value:  "All Pass",
-					Inline: false,
-				},
-				{Name: "Date", Value: now.Format("2006-01-02"), Inline: true},
-				{Name: "Time", Value: now.Format("15:04:05"), Inline: true},
-			},
-		}
-	} else {
-		failedServicesStr := strings.Join(failedServices, "\n")
-		embed = DiscordEmbed{
-			Title: "Scheduled Report",
-			Color: 0xFF0000,
-			Fields: []DiscordField{
-				{
-					Name:   "Failing Services",
-					Value:  failedServicesStr,
-					Inline: false,
-				},
-				{Name: "Date", Value: now.Format("2006-01-02"), Inline: true},
-				{Name: "Time", Value: now.Format("15:04:05"), Inline: true},
-			},
-		}
-	}
-
-	message := Message{Embeds: []DiscordEmbed{embed}}
-	payload, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	return sendWithRetries(webhookURL, payload, retryCount, rateLimitResetTime, maxRetries)
+// AddressKey is the key of a target by protocol and address, which inframon
+// used for acknowledgements and incidents before targets had ids.
+func AddressKey(target InstanceStatus) string {
+	return fmt.Sprintf("inframon/%s/%s", strings.ToLower(target.Protocol), target.Address)
 }
 
-func SendSMTPMail(smtpDisable bool, smtpUsername string, smtpPassword string, smtpHost string, smtpTo string, smtpFrom string, smtpPort string, title string, description string, address string, service string, networkZone string, instanceType string) error {
-	if smtpDisable {
-		return fmt.Errorf("smtp push notifications disabled")
-	}
-
-	now := time.Now()
-	body := fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html lang="en">
-	<head>
-		<meta charset="UTF-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		<title>Inframon Notification</title>
-		<style>
-			body {
-				font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-				line-height: 1.6;
-				color: black; /* Force default color to black */
-				max-width: 600px;
-				margin: 0 auto;
-				padding: 20px;
-				background-color: #f2f2f2;
-				justify-content: center;
-				display: grid;
-			}
-			.container {
-				background-color: #ffffff;
-				border-radius: 8px;
-				box-shadow: 0 2px 4px rgba(0,0,0,0.3);
-				padding: 10px;
-			}
-			.header {
-				background-color: #4682B4;
-				color: #ffffff;
-				padding: 15px;
-				border-radius: 8px 8px 0 0;
-				margin: -10px -10px 10px -10px;
-			}
-			h2 {
-				margin: 0;
-				font-size: 17px;
-				color: white; /* Ensure header text is white */
-			}
-			ul {
-				list-style-type: none;
-				padding: 0;
-				font-size: 12px;
-				color: black; /* Ensure list text is black */
-			}
-			li {
-				background-color: #f2f2f2;
-				color: black; /* Ensure list item text is black */
-				margin-bottom: 10px;
-				padding: 15px;
-				border-radius: 5px;
-				border-left: 5px solid #4682B4;
-				transition: all 0.3s ease;
-			}
-			strong {
-				color: #4682B4;
-				font-weight: 600;
-			}
-			.footer {
-				text-align: center;
-				margin-top: 20px;
-				font-size: 14px;
-				color: #888888;
-			}
-		</style>
-	</head>
-	<body>
-		<div class="container">
-			<div class="header">
-				<h2>Inframon Notification</h2>
-			</div>
-			<ul>
-			<li><strong>Status:</strong> %s</li>
-			<li><strong>Notification:</strong> %s</li>
-			<li><strong>Date:</strong> %s</li>
-			<li><strong>Time:</strong> %s</li>
-			<li><strong>Address:</strong> %s</li>
-			<li><strong>Service:</strong> %s</li>
-			<li><strong>NetworkZone:</strong> %s</li>
-			<li><strong>InstanceType:</strong> %s</li>
-			</ul>
-			<div class="footer">
-				This is an automated notification. Please do not reply.
-			</div>
-		</div>
-	</body>
-	</html>
-	`,
-		title,
-		description,
-		now.Format("2006-01-02"),
-		now.Format("15:04:05"),
-		address,
-		service,
-		networkZone,
-		instanceType,
-	)
-
-	subject := fmt.Sprintf("Inframon: %s :: %s :: %s", title, description, service)
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
-	to := []string{smtpTo}
+// RetryAfterError is returned when the receiver asked us to slow down, with the
+// delay from its Retry-After header if it sent one.
+type RetryAfterError struct {
+	After time.Duration
+	Err   error
+}
 
-	headers := make(map[string]string)
-	headers["From"] = smtpFrom
-	headers["To"] = smtpTo
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
 
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+func newRetryAfterError(resp *http.Response) *RetryAfterError {
+	var after time.Duration
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		after = time.Duration(seconds * float64(time.Second))
+	} else if date, err := http.ParseTime(value); err == nil {
+		after = time.Until(date)
 	}
-	message += "\r\n" + body
+	return &RetryAfterError{After: after, Err: fmt.Errorf("rate limited")}
+}
 
-	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
-	err := smtp.SendMail(addr, auth, smtpFrom, to, []byte(message))
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+// RetryDelay returns how long the receiver asked to wait before retrying, or
+// fallback if it did not say.
+func RetryDelay(err error, fallback time.Duration) time.Duration {
+	var retryAfter *RetryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.After > fallback {
+		return retryAfter.After
 	}
-	return nil
+	return fallback
 }
 
-func SendSMTPMailSystem(smtpDisable bool, smtpUsername string, smtpPassword string, smtpHost string, smtpTo string, smtpFrom string, smtpPort string, title string, description string) error {
-	if smtpDisable {
-		return fmt.Errorf("smtp push notifications disabled")
+func sendJSONRequest(method string, url string, headers map[string]string, payload []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
-
-	now := time.Now()
-	body := fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html lang="en">
-	<head>
-		<meta charset="UTF-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		<title>Inframon Notification</title>
-		<style>
-			body {
-				font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-				line-height: 1.6;
-				color: black; /* Force default color to black */
-				max-width: 600px;
-				margin: 0 auto;
-				padding: 20px;
-				background-color: #f2f2f2;
-				justify-content: center;
-				display: grid;
-			}
-			.container {
-				background-color: #ffffff;
-				border-radius: 8px;
-				box-shadow: 0 2px 4px rgba(0,0,0,0.3);
-				padding: 10px;
-			}
-			.header {
-				background-color: #4682B4;
-				color: #ffffff;
-				padding: 15px;
-				border-radius: 8px 8px 0 0;
-				margin: -10px -10px 10px -10px;
-			}
-			h2 {
-				margin: 0;
-				font-size: 17px;
-				color: white; /* Ensure header text is white */
-			}
-			ul {
-				list-style-type: none;
-				padding: 0;
-				font-size: 12px;
-				color: black; /* Ensure list text is black */
-			}
-			li {
-				background-color: #f2f2f2;
-				color: black; /* Ensure list item text is black */
-				margin-bottom: 10px;
-				padding: 15px;
-				border-radius: 5px;
-				border-left: 5px solid #4682B4;
-				transition: all 0.3s ease;
-			}
-			strong {
-				color: #4682B4;
-				font-weight: 600;
-			}
-			.footer {
-				text-align: center;
-				margin-top: 20px;
-				font-size: 14px;
-				color: #888888;
-			}
-		</style>
-	</head>
-	<body>
-		<div class="container">
-			<div class="header">
-				<h2>Inframon Notification</h2>
-			</div>
-			<ul>
-				<li><strong>Status:</strong> %s</li>
-				<li><strong>Description:</strong> %s</li>
-				<li><strong>Date:</strong> %s</li>
-				<li><strong>Time:</strong> %s</li>
-			</ul>
-			<div class="footer">
-				This is an automated notification. Please do not reply.
-			</div>
-		</div>
-	</body>
-	</html>	
-	`,
-		title,
-		description,
-		now.Format("2006-01-02"),
-		now.Format("15:04:05"),
-	)
-
-	subject := fmt.Sprintf("Inframon: %s :: %s", title, description)
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
-	to := []string{smtpTo}
-
-	headers := make(map[string]string)
-	headers["From"] = smtpFrom
-	headers["To"] = smtpTo
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
-
-	message := ""
+	req.Header.Set("Content-Type", "application/json")
 	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+		req.Header.Set(k, v)
 	}
-	message += "\r\n" + body
-
-	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
-	err := smtp.SendMail(addr, auth, smtpFrom, to, []byte(message))
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == StatusTooManyRequests {
+		return newRetryAfterError(resp)
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
 	}
 	return nil
 }
 
-func SendStatusSummaryToSMTP(smtpDisable bool, healthCronSmtpDisable bool, smtpUsername string, smtpPassword string, smtpHost string, smtpTo string, smtpFrom string, smtpPort string, icmpStatuses []InstanceStatus, httpStatuses []InstanceStatus) error {
-	if smtpDisable {
-		return fmt.Errorf("smtp notifications disabled")
-	}
-	if healthCronSmtpDisable {
-		return fmt.Errorf("health cron smtp notifications disabled")
-	}
-
-	var failedServices []string
-	for _, status := range icmpStatuses {
-		if !status.Status {
-			failedServices = append(failedServices, fmt.Sprintf("ICMP: %s (%s)", status.Address, status.Service))
-		}
-	}
-	for _, status := range httpStatuses {
-		if !status.Status {
-			failedServices = append(failedServices, fmt.Sprintf("HTTP: %s (%s)", status.Address, status.Service))
-		}
-	}
-
-	now := time.Now()
-	subject := "Inframon: Scheduled Report"
-	var status, statusColor string
-
-	if len(failedServices) == 0 {
-		status = "All Pass"
-		statusColor = "#00a600"
-	} else {
-		status = "Failing Services"
-		statusColor = "#b70000"
-	}
-
-	body := fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html lang="en">
-	<head>
-		<meta charset="UTF-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		<title>Inframon Scheduled Report</title>
-		<style>
-			body {
-				font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-				line-height: 1.6;
-				color: black; /* Force default color to black */
-				max-width: 600px;
-				margin: 0 auto;
-				padding: 20px;
-				background-color: #f2f2f2;
-			}
-			.container {
-				background-color: #ffffff;
-				border-radius: 8px;
-				box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-				padding: 20px;
-			}
-			.header {
-				background-color: #4682B4;
-				color: white; /* Ensure header text is white */
-				padding: 15px;
-				border-radius: 8px 8px 0 0;
-				margin: -20px -20px 20px -20px;
-			}
-			h2 {
-				margin: 0;
-				font-size: 24px;
-				color: white; /* Force header text to be white */
-			}
-			.h3-failing-services {
-				background-color: #4682B4;
-				color: white; /* Ensure header text is white */
-				padding: 10px;
-				border-radius: 6px 6px 0 0;
-				margin: 20px 0 10px 0;
-				font-size: 20px;
-			}
-			.status-label {
-				font-size: 14px;
-				font-weight: bold;
-				color: black; /* Force default color to black */
-			}
-			.status-text {
-				font-size: 14px;
-				font-weight: bold;
-				color: %s; /* Apply status color here */
-			}
-			ul {
-				list-style-type: none;
-				padding: 0;
-			}
-			li {
-				font-size: 14px;
-				background-color: #f8f8f8;
-				margin-bottom: 10px;
-				padding: 10px;
-				border-radius: 5px;
-				color: black; /* Ensure list item text is black */
-			}
-			.footer {
-				text-align: center;
-				margin-top: 20px;
-				font-size: 14px;
-				color: #888888; /* Keep footer in grey */
-			}
-		</style>
-	</head>
-	<body>
-		<div class="container">
-			<div class="header">
-				<h2>Inframon Scheduled Report</h2>
-			</div>
-			<ul>
-				<li>
-					<div class="status-label">Status: <span class="status-text">%s</span></div>
-				</li>
-				<li><strong>Date:</strong> <span style="color: black;">%s</span></li>
-				<li><strong>Time:</strong> <span style="color: black;">%s</span></li>
-			</ul>
-			%s
-			<div class="footer">
-				This is an automated notification. Please do not reply.
-			</div>
-		</div>
-	</body>
-	</html>
-	`,
-		statusColor,
-		status,
-		now.Format("2006-01-02"),
-		now.Format("15:04:05"),
-		func() string {
-			if len(failedServices) > 0 {
-				return `<h3 class="h3-failing-services">Failing Services:</h3><ul><li>` + strings.Join(failedServices, "</li><li>") + `</li></ul>`
-			}
-			return ""
-		}(),
-	)
-
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
-	to := []string{smtpTo}
-
-	headers := make(map[string]string)
-	headers["From"] = smtpFrom
-	headers["To"] = smtpTo
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
-
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + body
-
-	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
-	err := smtp.SendMail(addr, auth, smtpFrom, to, []byte(message))
+func SendSMTPMail(smtpConfig SMTPConfig, templates *Templates, event Event) error {
+	subject, text, html, err := templates.RenderEmail(event)
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return err
 	}
-	return nil
+	return sendMail(smtpConfig, subject, text, html)
 }
@@ -0,0 +1,101 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	OpsgenieDefaultURL       = "https://api.opsgenie.com"
+	OpsgenieDefaultPriority  = "P2"
+	opsgenieAlertsPath       = "/v2/alerts"
+	opsgenieMessageLimit     = 130
+	opsgenieDescriptionLimit = 15000
+)
+
+type OpsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Priority    string            `json:"priority,omitempty"`
+}
+
+type OpsgenieClose struct {
+	Source string `json:"source,omitempty"`
+	User   string `json:"user,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+func SendToOpsgenie(baseURL string, apiKey string, priority string, title string, description string, instance InstanceStatus) error {
+	if apiKey == "" {
+		return fmt.Errorf("opsgenie api key is empty")
+	}
+	if baseURL == "" {
+		baseURL = OpsgenieDefaultURL
+	}
+	if priority == "" {
+		priority = OpsgenieDefaultPriority
+	}
+
+	alias := DedupKey(instance)
+	alertsURL := strings.TrimSuffix(baseURL, "/") + opsgenieAlertsPath
+	headers := map[string]string{"Authorization": "GenieKey " + apiKey}
+
+	var requestURL string
+	var body interface{}
+	if instance.Status {
+		requestURL = fmt.Sprintf("%s/%s/close?identifierType=alias", alertsURL, url.PathEscape(alias))
+		body = OpsgenieClose{
+			Source: "Inframon",
+			User:   "Inframon",
+			Note:   fmt.Sprintf("%s :: %s :: %s (%s)", title, description, instance.Service, instance.Address),
+		}
+	} else {
+		requestURL = alertsURL
+		alert := OpsgenieAlert{
+			Message:     truncateUTF8(fmt.Sprintf("%s :: %s (%s)", title, instance.Service, instance.Address), opsgenieMessageLimit),
+			Alias:       alias,
+			Description: truncateUTF8(fmt.Sprintf("%s :: %s :: %s (%s)", title, description, instance.Service, instance.Address), opsgenieDescriptionLimit),
+			Tags:        []string{instance.Protocol, instance.NetworkZone, instance.InstanceType},
+			Details: map[string]string{
+				"address":      instance.Address,
+				"service":      instance.Service,
+				"protocol":     instance.Protocol,
+				"networkZone":  instance.NetworkZone,
+				"instanceType": instance.InstanceType,
+			},
+			Entity:   instance.Service,
+			Source:   "Inframon",
+			Priority: priority,
+		}
+		for name, value := range instance.Labels {
+			alert.Tags = append(alert.Tags, name+":"+value)
+			alert.Details[name] = value
+		}
+		body = alert
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return sendJSONRequest("POST", requestURL, headers, payload)
+}
+
+// truncateUTF8 cuts text to at most limit bytes without splitting a character.
+func truncateUTF8(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
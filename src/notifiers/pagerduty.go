@@ -0,0 +1,81 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	PagerDutyDefaultURL = "https://events.pagerduty.com"
+	pagerDutyEventsPath = "/v2/enqueue"
+)
+
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func SendToPagerDuty(baseURL string, routingKey string, title string, description string, instance InstanceStatus) error {
+	if routingKey == "" {
+		return fmt.Errorf("pagerduty routing key is empty for address: %s", instance.Address)
+	}
+	if baseURL == "" {
+		baseURL = PagerDutyDefaultURL
+	}
+
+	event := PagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "resolve",
+		DedupKey:    DedupKey(instance),
+		Client:      "Inframon",
+	}
+	if !instance.Status {
+		severity := instance.Severity
+		if severity == "" {
+			severity = "critical"
+		}
+		event.EventAction = "trigger"
+		event.Payload = &PagerDutyPayload{
+			Summary:   fmt.Sprintf("%s :: %s :: %s (%s)", title, description, instance.Service, instance.Address),
+			Source:    instance.Address,
+			Severity:  severity,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Component: instance.Service,
+			Group:     instance.NetworkZone,
+			Class:     instance.InstanceType,
+			CustomDetails: map[string]string{
+				"address":      instance.Address,
+				"service":      instance.Service,
+				"protocol":     instance.Protocol,
+				"networkZone":  instance.NetworkZone,
+				"instanceType": instance.InstanceType,
+			},
+		}
+		for name, value := range instance.Labels {
+			event.Payload.CustomDetails[name] = value
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	url := strings.TrimSuffix(baseURL, "/") + pagerDutyEventsPath
+	return sendJSONRequest("POST", url, nil, payload)
+}
@@ -0,0 +1,282 @@
+package notifiers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "implicit"
+	SMTPAuthNone    = "none"
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	smtpDialTimeout = 30 * time.Second
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       string
+	Cc       string
+	Bcc      string
+	TLS      string
+	Auth     string
+}
+
+func ParseAddressList(list string) ([]*mail.Address, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	return mail.ParseAddressList(list)
+}
+
+func sendMail(config SMTPConfig, subject string, textBody string, htmlBody string) error {
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	to, err := ParseAddressList(config.To)
+	if err != nil {
+		return fmt.Errorf("invalid to address list: %w", err)
+	}
+	cc, err := ParseAddressList(config.Cc)
+	if err != nil {
+		return fmt.Errorf("invalid cc address list: %w", err)
+	}
+	bcc, err := ParseAddressList(config.Bcc)
+	if err != nil {
+		return fmt.Errorf("invalid bcc address list: %w", err)
+	}
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return fmt.Errorf("no recipients configured")
+	}
+
+	message, err := buildMessage(from, to, cc, subject, textBody, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	var recipients []string
+	for _, list := range [][]*mail.Address{to, cc, bcc} {
+		for _, addr := range list {
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	if err := deliverMail(config, from.Address, recipients, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func buildMessage(from *mail.Address, to []*mail.Address, cc []*mail.Address, subject string, textBody string, htmlBody string) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=\"utf-8\"", textBody},
+		{"text/html; charset=\"utf-8\"", htmlBody},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mime part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(writer)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to encode mime part: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode mime part: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close mime message: %w", err)
+	}
+
+	// Headers are written in a fixed order; Bcc recipients are only added to the envelope.
+	headers := [][2]string{
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"From", from.String()},
+		{"To", joinAddresses(to)},
+		{"Cc", joinAddresses(cc)},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Message-ID", messageID(from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", parts.Boundary())},
+	}
+	var message bytes.Buffer
+	for _, header := range headers {
+		if header[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	formatted := make([]string, len(addresses))
+	for i, addr := range addresses {
+		formatted[i] = addr.String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func messageID(from string) string {
+	domain := "inframon.local"
+	if at := strings.LastIndex(from, "@"); at != -1 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Sprintf("<%d@%s>", time.Now().UnixNano(), domain)
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+func deliverMail(config SMTPConfig, from string, recipients []string, message []byte) error {
+	addr := net.JoinHostPort(config.Host, config.Port)
+	tlsConfig := &tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+	if strings.ToLower(config.TLS) == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpDialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(2 * smtpDialTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	switch strings.ToLower(config.TLS) {
+	case SMTPTLSStartTLS:
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls failed: %w", err)
+		}
+	case "":
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("starttls failed: %w", err)
+			}
+		}
+	}
+
+	if auth := smtpAuth(config); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("server %s does not support AUTH", addr)
+		}
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", rcpt, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func smtpAuth(config SMTPConfig) smtp.Auth {
+	switch strings.ToLower(config.Auth) {
+	case SMTPAuthNone:
+		return nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: config.Username, password: config.Password, host: config.Host}
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(config.Username, config.Password)
+	default:
+		if config.Username == "" {
+			return nil
+		}
+		return smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+}
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
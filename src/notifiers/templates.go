@@ -0,0 +1,217 @@
+package notifiers
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplateFS embed.FS
+
+var templateFiles = map[string]string{
+	"discordTransition":   "discord_transition.json.tmpl",
+	"discordSystem":       "discord_system.json.tmpl",
+	"discordSummary":      "discord_summary.json.tmpl",
+	"discordDigest":       "discord_digest.json.tmpl",
+	"emailTransitionText": "email_transition.txt.tmpl",
+	"emailTransitionHtml": "email_transition.html.tmpl",
+	"emailSystemText":     "email_system.txt.tmpl",
+	"emailSystemHtml":     "email_system.html.tmpl",
+	"emailSummaryText":    "email_summary.txt.tmpl",
+	"emailSummaryHtml":    "email_summary.html.tmpl",
+	"emailDigestText":     "email_digest.txt.tmpl",
+	"emailDigestHtml":     "email_digest.html.tmpl",
+}
+
+var templateFuncs = map[string]interface{}{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"join":    strings.Join,
+	"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"date":    func(t time.Time) string { return t.Format("2006-01-02") },
+	"clock":   func(t time.Time) string { return t.Format("15:04:05") },
+	"failing": func(statuses []InstanceStatus) []InstanceStatus {
+		var failed []InstanceStatus
+		for _, status := range statuses {
+			if !status.Status {
+				failed = append(failed, status)
+			}
+		}
+		return failed
+	},
+	"acknowledged": describeAcknowledgement,
+	"labels":       FormatLabels,
+	"byZone":       groupByZone,
+	"describe": func(statuses []InstanceStatus) []string {
+		lines := make([]string, len(statuses))
+		for i, status := range statuses {
+			lines[i] = fmt.Sprintf("%s: %s (%s)", status.Protocol, status.Address, status.Service)
+		}
+		return lines
+	},
+}
+
+func describeAcknowledgement(ack *Acknowledgement) string {
+	description := fmt.Sprintf("%s at %s", ack.Author, ack.Time.Format("2006-01-02 15:04:05"))
+	if ack.Comment != "" {
+		description += fmt.Sprintf(" (%s)", ack.Comment)
+	}
+	return description
+}
+
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+func TemplateNames() []string {
+	names := make([]string, 0, len(templateFiles))
+	for name := range templateFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func DefaultTemplates() *Templates {
+	templates, err := LoadTemplates(nil)
+	if err != nil {
+		panic(fmt.Sprintf("embedded notification templates are invalid: %v", err))
+	}
+	return templates
+}
+
+// LoadTemplates parses the embedded templates and replaces any that have a path
+// in overrides. An override is parsed on top of its default, so it only needs to
+// redefine the parts it changes, e.g. the "subject" block of an email text template.
+func LoadTemplates(overrides map[string]string) (*Templates, error) {
+	for name := range overrides {
+		if _, ok := templateFiles[name]; !ok {
+			return nil, fmt.Errorf("unknown template %s, expected one of: %s", name, strings.Join(TemplateNames(), ", "))
+		}
+	}
+
+	templates := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for name, file := range templateFiles {
+		sources := []string{}
+		data, err := defaultTemplateFS.ReadFile("templates/" + file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded template %s: %w", file, err)
+		}
+		sources = append(sources, string(data))
+		if path := overrides[name]; path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+			}
+			sources = append(sources, string(data))
+		}
+
+		if strings.HasSuffix(file, ".html.tmpl") {
+			tmpl := htmltemplate.New(file).Funcs(templateFuncs)
+			for _, source := range sources {
+				if tmpl, err = tmpl.Parse(source); err != nil {
+					return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+				}
+			}
+			templates.html[name] = tmpl
+		} else {
+			tmpl := texttemplate.New(file).Funcs(templateFuncs)
+			for _, source := range sources {
+				if tmpl, err = tmpl.Parse(source); err != nil {
+					return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+				}
+			}
+			templates.text[name] = tmpl
+		}
+	}
+
+	// Render every template against sample events so mistakes fail at startup.
+	sample := InstanceStatus{Address: "10.0.0.1", Service: "sample", NetworkZone: "ZONE", InstanceType: "VM", Protocol: "ICMP"}
+	transition := Event{Kind: EventKindTransition, Title: "Connection Interrupted", Description: "ICMP Monitor", State: StateDown, Target: sample, Error: "sample", Timestamp: time.Now(), Acknowledgement: &Acknowledgement{Author: "sample", Time: time.Now()}}
+	for _, event := range []Event{
+		transition,
+		{Kind: EventKindSystem, Title: "Starting Service", Description: "Booting", Timestamp: time.Now()},
+		{Kind: EventKindSummary, Title: "Scheduled Report", Statuses: []InstanceStatus{sample}, Timestamp: time.Now()},
+	} {
+		if _, err := templates.RenderDiscord(event); err != nil {
+			return nil, err
+		}
+		if _, _, _, err := templates.RenderEmail(event); err != nil {
+			return nil, err
+		}
+	}
+	digest := NewDigestEvent([]Event{transition, transition}, 1)
+	if _, err := templates.RenderDiscordDigest(digest); err != nil {
+		return nil, err
+	}
+	if _, _, _, err := templates.RenderEmail(digest); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func templateKind(event Event) string {
+	switch event.Kind {
+	case EventKindTransition:
+		return "Transition"
+	case EventKindSummary:
+		return "Summary"
+	case EventKindDigest:
+		return "Digest"
+	default:
+		return "System"
+	}
+}
+
+func (t *Templates) RenderDiscord(event Event) (DiscordEmbed, error) {
+	var embed DiscordEmbed
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	name := "discord" + templateKind(event)
+	var buf bytes.Buffer
+	if err := t.text[name].Execute(&buf, event); err != nil {
+		return embed, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &embed); err != nil {
+		return embed, fmt.Errorf("template %s did not render a valid discord embed: %w", name, err)
+	}
+	return embed, nil
+}
+
+func (t *Templates) RenderEmail(event Event) (string, string, string, error) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	kind := templateKind(event)
+	textTemplate := t.text["email"+kind+"Text"]
+	htmlTemplate := t.html["email"+kind+"Html"]
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, "subject", event); err != nil {
+		return "", "", "", fmt.Errorf("failed to render subject of template email%sText: %w", kind, err)
+	}
+	if err := textTemplate.Execute(&text, event); err != nil {
+		return "", "", "", fmt.Errorf("failed to render template email%sText: %w", kind, err)
+	}
+	if err := htmlTemplate.Execute(&html, event); err != nil {
+		return "", "", "", fmt.Errorf("failed to render template email%sHtml: %w", kind, err)
+	}
+	return strings.TrimSpace(subject.String()), text.String(), html.String(), nil
+}
@@ -0,0 +1,99 @@
+package notifiers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	WebhookDefaultMethod = "POST"
+	WebhookDefaultBody   = "{{ json . }}"
+)
+
+type WebhookTemplate struct {
+	method  string
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+func NewWebhookTemplate(rawURL string, method string, headers map[string]string, body string) (*WebhookTemplate, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("webhook url cannot be empty")
+	}
+	if method == "" {
+		method = WebhookDefaultMethod
+	}
+	if body == "" {
+		body = WebhookDefaultBody
+	}
+
+	webhook := &WebhookTemplate{
+		method:  strings.ToUpper(method),
+		headers: make(map[string]*template.Template),
+	}
+	var err error
+	webhook.url, err = template.New("url").Funcs(templateFuncs).Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook url template: %w", err)
+	}
+	webhook.body, err = template.New("body").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook body template: %w", err)
+	}
+	for name, value := range headers {
+		webhook.headers[name], err = template.New(name).Funcs(templateFuncs).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse webhook header template %s: %w", name, err)
+		}
+	}
+
+	// Render against a sample event so field typos fail at startup rather than mid-outage.
+	if _, _, _, err := webhook.render(Event{Kind: EventKindTransition, Timestamp: time.Now()}); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (w *WebhookTemplate) render(event Event) (string, map[string]string, []byte, error) {
+	var buf bytes.Buffer
+	if err := w.url.Execute(&buf, event); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to render webhook url: %w", err)
+	}
+	renderedURL := strings.TrimSpace(buf.String())
+	parsed, err := url.Parse(renderedURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", nil, nil, fmt.Errorf("rendered webhook url is not a valid http or https url: %s", renderedURL)
+	}
+
+	headers := make(map[string]string)
+	for name, tmpl := range w.headers {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, event); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to render webhook header %s: %w", name, err)
+		}
+		headers[name] = buf.String()
+	}
+
+	buf.Reset()
+	if err := w.body.Execute(&buf, event); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to render webhook body: %w", err)
+	}
+	return renderedURL, headers, buf.Bytes(), nil
+}
+
+func (w *WebhookTemplate) Send(event Event) error {
+	renderedURL, headers, payload, err := w.render(event)
+	if err != nil {
+		return err
+	}
+	if w.method == http.MethodGet || w.method == http.MethodDelete {
+		payload = nil
+	}
+	return sendJSONRequest(w.method, renderedURL, headers, payload)
+}
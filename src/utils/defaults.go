@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TargetDefaults holds the settings every ICMP or HTTP target starts from.
+type TargetDefaults struct {
+	ICMP TargetTemplate `yaml:"icmp"`
+	HTTP TargetTemplate `yaml:"http"`
+}
+
+// TargetTemplate is a named set of target settings. A target that names it with
+// template gets every setting it does not set itself. Settings that do not apply
+// to the protocol of the target, such as skipVerify for ICMP, are ignored.
+type TargetTemplate struct {
+	Timeout             int               `yaml:"timeout"`
+	FailureTimeout      int               `yaml:"failureTimeout"`
+	RetryBuffer         int               `yaml:"retryBuffer"`
+	SkipVerify          bool              `yaml:"skipVerify"`
+	NetworkZone         string            `yaml:"networkZone"`
+	InstanceType        string            `yaml:"instanceType"`
+	PagerDutyRoutingKey string            `yaml:"pagerDutyRoutingKey" secret:"true"`
+	RunbookURL          string            `yaml:"runbookUrl"`
+	Severity            string            `yaml:"severity"`
+	Tags                []string          `yaml:"tags"`
+	Labels              map[string]string `yaml:"labels"`
+}
+
+// applyDefaults fills in the settings of every target from its template, then
+// from the defaults of its protocol. A setting of the target wins over its
+// template, which wins over the defaults, label by label for labels.
+func (s *configSource) applyDefaults(problems *[]Problem) {
+	templates := mappingValue(s.document, "templates")
+	for _, section := range mergedSections {
+		list := mappingValue(s.document, section)
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		fields := targetFields(section)
+		defaults := mappingValue(mappingValue(s.document, "defaults"), section)
+		for i, item := range list.Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			var template *yaml.Node
+			if name := mappingValue(item, "template"); name != nil {
+				if template = mappingValue(templates, name.Value); template == nil {
+					*problems = append(*problems, nodeProblem(s.owner(name), name, "template %s is not defined", name.Value))
+				}
+			}
+			if template == nil && defaults == nil {
+				continue
+			}
+			target := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: item.Line, Column: item.Column}
+			target.Content = append(target.Content, item.Content...)
+			for _, inherited := range []*yaml.Node{template, defaults} {
+				if inherited == nil || inherited.Kind != yaml.MappingNode {
+					continue
+				}
+				for j := 0; j+1 < len(inherited.Content); j += 2 {
+					key, value := inherited.Content[j], inherited.Content[j+1]
+					if _, ok := fields[key.Value]; !ok {
+						continue
+					}
+					own := mappingValue(target, key.Value)
+					if own == nil {
+						target.Content = append(target.Content, key, value)
+						continue
+					}
+					// Labels are inherited one by one.
+					if own.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+						merged := mergeMappings(own, value)
+						s.owners[merged] = s.owner(own)
+						setMappingValue(target, key.Value, merged)
+					}
+				}
+			}
+			s.owners[target] = s.owner(item)
+			list.Content[i] = target
+		}
+	}
+}
+
+// mergeMappings returns a mapping with the keys of own, and the keys of inherited
+// that own does not have.
+func mergeMappings(own *yaml.Node, inherited *yaml.Node) *yaml.Node {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: own.Tag, Line: own.Line, Column: own.Column}
+	merged.Content = append(merged.Content, own.Content...)
+	for i := 0; i+1 < len(inherited.Content); i += 2 {
+		if !hasKey(merged, inherited.Content[i].Value) {
+			merged.Content = append(merged.Content, inherited.Content[i], inherited.Content[i+1])
+		}
+	}
+	return merged
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+}
+
+// targetFields returns the yaml fields of the targets of a section of Config.
+func targetFields(section string) map[string]reflect.Type {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == section {
+			return yamlFields(t.Field(i).Type.Elem())
+		}
+	}
+	return nil
+}
+
+// RenderConfig returns the configuration at path as inframon sees it, with
+// includes merged, defaults and templates applied and references resolved. The
+// defaults and templates themselves are left out, and secrets are redacted.
+func RenderConfig(path string) (string, error) {
+	source, problems := loadSource(path)
+	if len(problems) == 0 {
+		var config *Config
+		if config, problems = source.decode(); len(problems) == 0 {
+			registerSecrets(reflect.ValueOf(config))
+		}
+	}
+	if len(problems) > 0 {
+		return "", joinProblems(problems)
+	}
+
+	document := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(source.document.Content); i += 2 {
+		key, value := source.document.Content[i], source.document.Content[i+1]
+		if key.Value == "defaults" || key.Value == "templates" {
+			continue
+		}
+		if contains(mergedSections, key.Value) && value.Kind == yaml.SequenceNode {
+			value = withoutTemplateKeys(value)
+		}
+		document.Content = append(document.Content, key, value)
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return Redact(out.String()), nil
+}
+
+func withoutTemplateKeys(list *yaml.Node) *yaml.Node {
+	copied := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			copied.Content = append(copied.Content, item)
+			continue
+		}
+		target := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			if item.Content[i].Value != "template" {
+				target.Content = append(target.Content, item.Content[i], item.Content[i+1])
+			}
+		}
+		copied.Content = append(copied.Content, target)
+	}
+	return copied
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const inheritedSettings = `defaults:
+  icmp:
+    timeout: 5
+    retryBuffer: 3
+    networkZone: "LAN"
+    severity: "warning"
+    labels:
+      team: "infra"
+      site: "home"
+  http:
+    timeout: 5
+    retryBuffer: 3
+    skipVerify: true
+templates:
+  quiet:
+    timeout: 9
+    retryBuffer: 2
+    networkZone: "DMZ"
+    skipVerify: true
+    tags: ["quiet"]
+    labels:
+      team: "web"
+  zero:
+    retryBuffer: 0
+    networkZone: ""
+`
+
+func TestApplyDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		icmp     string
+		http     string
+		want     ICMPTarget
+		wantHTTP *HTTPTarget
+	}{
+		{
+			name: "defaults fill unset settings",
+			icmp: `address: "10.0.0.1"`,
+			want: ICMPTarget{TargetMeta{Timeout: 5, RetryBuffer: 3, NetworkZone: "LAN", Severity: "warning", Labels: map[string]string{"team": "infra", "site": "home"}}},
+		},
+		{
+			name: "template wins over defaults",
+			icmp: `address: "10.0.0.1"
+    template: quiet`,
+			want: ICMPTarget{TargetMeta{Timeout: 9, RetryBuffer: 2, NetworkZone: "DMZ", Severity: "warning", Tags: []string{"quiet"}, Labels: map[string]string{"team": "web", "site": "home"}}},
+		},
+		{
+			name: "explicit zero wins over defaults",
+			icmp: `address: "10.0.0.1"
+    retryBuffer: 0
+    networkZone: ""
+    severity: ""`,
+			want: ICMPTarget{TargetMeta{Timeout: 5, Labels: map[string]string{"team": "infra", "site": "home"}}},
+		},
+		{
+			name: "explicit zero wins over template",
+			icmp: `address: "10.0.0.1"
+    template: quiet
+    retryBuffer: 0
+    tags: []`,
+			want: ICMPTarget{TargetMeta{Timeout: 9, NetworkZone: "DMZ", Severity: "warning", Tags: []string{}, Labels: map[string]string{"team": "web", "site": "home"}}},
+		},
+		{
+			name: "zero in a template wins over defaults",
+			icmp: `address: "10.0.0.1"
+    template: zero`,
+			want: ICMPTarget{TargetMeta{Timeout: 5, Severity: "warning", Labels: map[string]string{"team": "infra", "site": "home"}}},
+		},
+		{
+			name: "empty label wins over inherited label",
+			icmp: `address: "10.0.0.1"
+    template: quiet
+    labels:
+      team: ""`,
+			want: ICMPTarget{TargetMeta{Timeout: 9, RetryBuffer: 2, NetworkZone: "DMZ", Severity: "warning", Tags: []string{"quiet"}, Labels: map[string]string{"team": "", "site": "home"}}},
+		},
+		{
+			name: "explicit false wins over template",
+			http: `address: "https://10.0.0.1"
+    template: quiet
+    skipVerify: false`,
+			wantHTTP: &HTTPTarget{TargetMeta: TargetMeta{Timeout: 9, RetryBuffer: 2, NetworkZone: "DMZ", Tags: []string{"quiet"}, Labels: map[string]string{"team": "web"}}},
+		},
+		{
+			name: "explicit false wins over defaults",
+			http: `address: "https://10.0.0.1"
+    skipVerify: false`,
+			wantHTTP: &HTTPTarget{TargetMeta: TargetMeta{Timeout: 5, RetryBuffer: 3}},
+		},
+		{
+			name:     "unset boolean is inherited",
+			http:     `address: "https://10.0.0.1"`,
+			wantHTTP: &HTTPTarget{TargetMeta: TargetMeta{Timeout: 5, RetryBuffer: 3}, SkipVerify: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := inheritedSettings
+			if test.icmp != "" {
+				content += "icmp:\n  - " + test.icmp + "\n"
+			}
+			if test.http != "" {
+				content += "http:\n  - " + test.http + "\n"
+			}
+			dir := writeFiles(t, map[string]string{"config.yaml": content})
+			source, problems := loadSource(filepath.Join(dir, "config.yaml"))
+			if len(problems) > 0 {
+				t.Fatalf("unexpected problems %v", problems)
+			}
+			config, problems := source.decode()
+			if len(problems) > 0 {
+				t.Fatalf("unexpected problems %v", problems)
+			}
+			// Only the inherited settings are compared.
+			if test.wantHTTP != nil {
+				got := config.HTTP[0]
+				got.ID, got.Address, got.Template = "", "", ""
+				if !reflect.DeepEqual(got, *test.wantHTTP) {
+					t.Errorf("got %+v, want %+v", got, *test.wantHTTP)
+				}
+				return
+			}
+			got := config.ICMP[0]
+			got.ID, got.Address, got.Template = "", "", ""
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergedSections are the top-level lists that may be split across files. Every
+// other section may only be set in one file.
+var mergedSections = []string{"icmp", "http"}
+
+type configFile struct {
+	name     string
+	document *yaml.Node
+}
+
+// configSource is a configuration made of one or more files. A configuration
+// path is either a file, whose include globs are loaded along with it, or a
+// directory, whose .yaml and .yml files are all loaded in name order.
+type configSource struct {
+	files    []configFile
+	document *yaml.Node
+	owners   map[*yaml.Node]string
+}
+
+func loadSource(path string) (*configSource, []Problem) {
+	s := &configSource{owners: make(map[*yaml.Node]string)}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, []Problem{fileProblem(path, err)}
+	}
+	var problems []Problem
+	loaded := make(map[string]bool)
+	if info.IsDir() {
+		names, err := configFiles(path)
+		if err != nil {
+			return nil, []Problem{fileProblem(path, err)}
+		}
+		if len(names) == 0 {
+			return nil, []Problem{{File: path, Severity: ProblemError, Message: "directory contains no .yaml or .yml files"}}
+		}
+		for _, name := range names {
+			s.load(name, loaded, &problems)
+		}
+	} else {
+		s.load(path, loaded, &problems)
+	}
+	if len(s.files) == 0 {
+		if len(problems) == 0 {
+			problems = append(problems, Problem{File: path, Severity: ProblemError, Message: "configuration file is empty"})
+		}
+		return nil, problems
+	}
+
+	s.merge(&problems)
+	s.applyDefaults(&problems)
+	s.checkDuplicates(&problems)
+	problems = append(problems, resolveReferences(s.document, s.owner)...)
+	return s, problems
+}
+
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+		// Stat follows symlinks, which is how Kubernetes mounts ConfigMap keys.
+		name := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load parses a file and the files it includes. A file is only loaded once, so an
+// include glob may match the including file or overlap with another glob.
+func (s *configSource) load(name string, loaded map[string]bool, problems *[]Problem) {
+	absolute, err := filepath.Abs(name)
+	if err != nil {
+		*problems = append(*problems, fileProblem(name, err))
+		return
+	}
+	if loaded[absolute] {
+		return
+	}
+	loaded[absolute] = true
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		*problems = append(*problems, fileProblem(name, err))
+		return
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		problem := yamlProblem(err.Error())
+		problem.File = name
+		*problems = append(*problems, problem)
+		return
+	}
+	if len(root.Content) == 0 {
+		return
+	}
+	document := root.Content[0]
+	if document.Kind != yaml.MappingNode {
+		*problems = append(*problems, Problem{File: name, Line: document.Line, Severity: ProblemError, Message: "configuration must be a mapping"})
+		return
+	}
+	s.own(document, name)
+	resolveNode(document, reflect.TypeOf(Config{}), name, problems)
+	configSchema.check(document, "", name, problems)
+	s.files = append(s.files, configFile{name: name, document: document})
+
+	includes := mappingValue(document, "include")
+	if includes == nil || includes.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, pattern := range includes.Content {
+		glob := pattern.Value
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(filepath.Dir(name), glob)
+		}
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			*problems = append(*problems, nodeProblem(name, pattern, "include %s is not a valid glob: %v", pattern.Value, err))
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern.Value, "*?[") {
+			*problems = append(*problems, nodeProblem(name, pattern, "include %s does not exist", pattern.Value))
+			continue
+		}
+		for _, match := range matches {
+			s.load(match, loaded, problems)
+		}
+	}
+}
+
+func (s *configSource) own(node *yaml.Node, name string) {
+	s.owners[node] = name
+	for _, child := range node.Content {
+		s.own(child, name)
+	}
+}
+
+// owner returns the file a node was read from.
+func (s *configSource) owner(node *yaml.Node) string {
+	if name, ok := s.owners[node]; ok {
+		return name
+	}
+	return s.files[0].name
+}
+
+// merge builds one document out of every file. The target lists are concatenated
+// in load order.
+func (s *configSource) merge(problems *[]Problem) {
+	s.document = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	s.owners[s.document] = s.files[0].name
+	lists := make(map[string]*yaml.Node)
+	setBy := make(map[string]*yaml.Node)
+	for _, file := range s.files {
+		for i := 0; i+1 < len(file.document.Content); i += 2 {
+			key, value := file.document.Content[i], file.document.Content[i+1]
+			if key.Value == "include" {
+				continue
+			}
+			if contains(mergedSections, key.Value) && value.Kind == yaml.SequenceNode {
+				list, ok := lists[key.Value]
+				if !ok {
+					list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: value.Line, Column: value.Column}
+					s.owners[list] = file.name
+					lists[key.Value] = list
+					s.document.Content = append(s.document.Content, key, list)
+				}
+				list.Content = append(list.Content, value.Content...)
+				continue
+			}
+			if previous, ok := setBy[key.Value]; ok {
+				*problems = append(*problems, nodeProblem(file.name, key, "%s is already set at %s:%d", key.Value, s.owner(previous), previous.Line))
+				continue
+			}
+			setBy[key.Value] = key
+			s.document.Content = append(s.document.Content, key, value)
+		}
+	}
+}
+
+// checkDuplicates reports targets that share an id, with the file of the first
+// one. Targets without an id are identified by their protocol and address.
+func (s *configSource) checkDuplicates(problems *[]Problem) {
+	first := make(map[string]*yaml.Node)
+	for _, section := range mergedSections {
+		list := mappingValue(s.document, section)
+		if list == nil {
+			continue
+		}
+		for _, item := range list.Content {
+			node, id := mappingValue(item, "id"), ""
+			if node != nil && node.Value != "" {
+				id = node.Value
+			} else if node = mappingValue(item, "address"); node != nil && node.Value != "" {
+				id = TargetID(section, node.Value)
+			} else {
+				continue
+			}
+			previous, ok := first[id]
+			if !ok {
+				first[id] = node
+				continue
+			}
+			if node.Value == id {
+				*problems = append(*problems, nodeProblem(s.owner(node), node, "target id %s is already used at %s:%d", id, s.owner(previous), previous.Line))
+			} else {
+				*problems = append(*problems, nodeProblem(s.owner(node), node, "%s target %s is already defined at %s:%d (set id to monitor it more than once)", section, node.Value, s.owner(previous), previous.Line))
+			}
+		}
+	}
+}
+
+// decode decodes the merged document. Type errors are reported per file, where
+// their line numbers belong.
+func (s *configSource) decode() (*Config, []Problem) {
+	var problems []Problem
+	for _, file := range s.files {
+		if err := file.document.Decode(&Config{}); err != nil {
+			for _, problem := range decodeProblems(err) {
+				problem.File = file.name
+				problems = append(problems, problem)
+			}
+		}
+	}
+	config := &Config{}
+	if err := s.document.Decode(config); err != nil && len(problems) == 0 {
+		for _, problem := range decodeProblems(err) {
+			problem.File = s.files[0].name
+			problems = append(problems, problem)
+		}
+	}
+	config.AssignTargetIDs()
+	return config, problems
+}
+
+func decodeProblems(err error) []Problem {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return []Problem{yamlProblem(err.Error())}
+	}
+	var problems []Problem
+	for _, message := range typeErr.Errors {
+		problems = append(problems, yamlProblem(message))
+	}
+	return problems
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func nodeProblem(file string, node *yaml.Node, format string, args ...interface{}) Problem {
+	return Problem{File: file, Line: node.Line, Column: node.Column, Severity: ProblemError, Message: fmt.Sprintf(format, args...)}
+}
+
+func joinProblems(problems []Problem) error {
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = problem
+	}
+	return errors.Join(errs...)
+}
+
+func fileProblem(name string, err error) Problem {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return Problem{File: name, Severity: ProblemError, Message: err.Error()}
+}
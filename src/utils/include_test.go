@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, by name relative to dir, and returns dir.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func icmpTarget(address string) string {
+	return "icmp:\n  - address: \"" + address + "\"\n"
+}
+
+func TestLoadSourceMergeOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		path  string
+		icmp  []string
+	}{
+		{
+			name: "directory in name order",
+			files: map[string]string{
+				"conf.d/20-more.yaml": icmpTarget("10.0.0.2"),
+				"conf.d/10-base.yaml": "configuration:\n  stdOut: true\n" + icmpTarget("10.0.0.1"),
+				"conf.d/05-first.yml": icmpTarget("10.0.0.5"),
+			},
+			path: "conf.d",
+			icmp: []string{"10.0.0.5", "10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name: "directory skips hidden and other files",
+			files: map[string]string{
+				"conf.d/a.yaml":       icmpTarget("10.0.0.1"),
+				"conf.d/.b.yaml":      icmpTarget("10.0.0.2"),
+				"conf.d/c.yaml.bak":   icmpTarget("10.0.0.3"),
+				"conf.d/d/e.yaml":     icmpTarget("10.0.0.4"),
+				"conf.d/notes.txt":    "not yaml",
+				"conf.d/z-last.yml":   icmpTarget("10.0.0.6"),
+				"conf.d/y-empty.yaml": "",
+			},
+			path: "conf.d",
+			icmp: []string{"10.0.0.1", "10.0.0.6"},
+		},
+		{
+			name: "including file first, then a glob in name order",
+			files: map[string]string{
+				"config.yaml":        "include:\n  - conf.d/*.yaml\n" + icmpTarget("10.0.0.1"),
+				"conf.d/b.yaml":      icmpTarget("10.0.0.3"),
+				"conf.d/a.yaml":      icmpTarget("10.0.0.2"),
+				"conf.d/ignored.yml": icmpTarget("10.0.0.9"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "includes in the order they are listed",
+			files: map[string]string{
+				"config.yaml": "include:\n  - z.yaml\n  - a.yaml\n" + icmpTarget("10.0.0.1"),
+				"z.yaml":      icmpTarget("10.0.0.2"),
+				"a.yaml":      icmpTarget("10.0.0.3"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "nested includes follow the file that includes them",
+			files: map[string]string{
+				"config.yaml": "include:\n  - a.yaml\n  - c.yaml\n" + icmpTarget("10.0.0.1"),
+				"a.yaml":      "include:\n  - b.yaml\n" + icmpTarget("10.0.0.2"),
+				"b.yaml":      icmpTarget("10.0.0.3"),
+				"c.yaml":      icmpTarget("10.0.0.4"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		{
+			name: "overlapping globs load a file once",
+			files: map[string]string{
+				"config.yaml":   "include:\n  - conf.d/a.yaml\n  - conf.d/*.yaml\n" + icmpTarget("10.0.0.1"),
+				"conf.d/a.yaml": icmpTarget("10.0.0.2"),
+				"conf.d/b.yaml": icmpTarget("10.0.0.3"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "a glob matching the including file loads it once",
+			files: map[string]string{
+				"config.yaml": "include:\n  - \"*.yaml\"\n" + icmpTarget("10.0.0.1"),
+				"b.yaml":      icmpTarget("10.0.0.2"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name: "include cycles load every file once",
+			files: map[string]string{
+				"config.yaml": "include:\n  - a.yaml\n" + icmpTarget("10.0.0.1"),
+				"a.yaml":      "include:\n  - config.yaml\n" + icmpTarget("10.0.0.2"),
+			},
+			path: "config.yaml",
+			icmp: []string{"10.0.0.1", "10.0.0.2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeFiles(t, test.files)
+			source, problems := loadSource(filepath.Join(dir, test.path))
+			if len(problems) > 0 {
+				t.Fatalf("unexpected problems %v", problems)
+			}
+			config, problems := source.decode()
+			if len(problems) > 0 {
+				t.Fatalf("unexpected problems %v", problems)
+			}
+			var icmp []string
+			for _, target := range config.ICMP {
+				icmp = append(icmp, target.Address)
+			}
+			if strings.Join(icmp, " ") != strings.Join(test.icmp, " ") {
+				t.Errorf("icmp targets %v, want %v", icmp, test.icmp)
+			}
+		})
+	}
+}
+
+func TestLoadSourceProblems(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		path  string
+		// want is the location and message of the only problem, with dir
+		// standing for the directory of the files, or empty for none.
+		want string
+	}{
+		{
+			name: "same id in two files",
+			files: map[string]string{
+				"conf.d/a.yaml": "icmp:\n  - id: gw\n    address: \"10.0.0.1\"\n",
+				"conf.d/b.yaml": "http:\n  - address: \"https://10.0.0.1\"\n  - id: gw\n    address: \"https://10.0.0.2\"\n",
+			},
+			path: "conf.d",
+			want: "dir/conf.d/b.yaml:3:9: target id gw is already used at dir/conf.d/a.yaml:2",
+		},
+		{
+			name: "same address without id in two files",
+			files: map[string]string{
+				"config.yaml": "include:\n  - more.yaml\n" + icmpTarget("10.0.0.1"),
+				"more.yaml":   "\n" + icmpTarget("10.0.0.1"),
+			},
+			path: "config.yaml",
+			want: "dir/more.yaml:3:14: icmp target 10.0.0.1 is already defined at dir/config.yaml:4 (set id to monitor it more than once)",
+		},
+		{
+			name: "same address in one file",
+			files: map[string]string{
+				"config.yaml": icmpTarget("10.0.0.1") + "  - address: \"10.0.0.1\"\n",
+			},
+			path: "config.yaml",
+			want: "dir/config.yaml:3:14: icmp target 10.0.0.1 is already defined at dir/config.yaml:2 (set id to monitor it more than once)",
+		},
+		{
+			name: "same address with different ids",
+			files: map[string]string{
+				"conf.d/a.yaml": "icmp:\n  - id: gw-a\n    address: \"10.0.0.1\"\n",
+				"conf.d/b.yaml": "icmp:\n  - id: gw-b\n    address: \"10.0.0.1\"\n",
+			},
+			path: "conf.d",
+		},
+		{
+			name: "same address in icmp and http",
+			files: map[string]string{
+				"config.yaml": icmpTarget("10.0.0.1") + "http:\n  - address: \"10.0.0.1\"\n",
+			},
+			path: "config.yaml",
+		},
+		{
+			name: "section set in two files",
+			files: map[string]string{
+				"conf.d/a.yaml": "configuration:\n  stdOut: true\n",
+				"conf.d/b.yaml": icmpTarget("10.0.0.1") + "configuration:\n  stdOut: false\n",
+			},
+			path: "conf.d",
+			want: "dir/conf.d/b.yaml:3:1: configuration is already set at dir/conf.d/a.yaml:1",
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": "include:\n  - missing.yaml\n" + icmpTarget("10.0.0.1"),
+			},
+			path: "config.yaml",
+			want: "dir/config.yaml:2:5: include missing.yaml does not exist",
+		},
+		{
+			name: "glob without matches",
+			files: map[string]string{
+				"config.yaml": "include:\n  - conf.d/*.yaml\n" + icmpTarget("10.0.0.1"),
+			},
+			path: "config.yaml",
+		},
+		{
+			name:  "directory without configuration files",
+			files: map[string]string{"conf.d/notes.txt": "not yaml"},
+			path:  "conf.d",
+			want:  "dir/conf.d: directory contains no .yaml or .yml files",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeFiles(t, test.files)
+			_, problems := loadSource(filepath.Join(dir, test.path))
+			var got []string
+			for _, problem := range problems {
+				got = append(got, strings.ReplaceAll(problem.Location(), dir, "dir")+": "+strings.ReplaceAll(problem.Message, dir, "dir"))
+			}
+			switch {
+			case test.want == "" && len(got) > 0:
+				t.Errorf("unexpected problems %q", got)
+			case test.want != "" && (len(got) != 1 || got[0] != test.want):
+				t.Errorf("problems %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ProblemError   = "error"
+	ProblemWarning = "warning"
+)
+
+// Problem is one finding of LintConfig. File is the configuration file the
+// problem is in. Line and Column are 1-based and zero when the problem cannot be
+// tied to a place in the file.
+type Problem struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// Location is file:line:column, leaving out what is not known.
+func (p Problem) Location() string {
+	location := p.File
+	if p.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, p.Line)
+		if p.Column > 0 {
+			location = fmt.Sprintf("%s:%d", location, p.Column)
+		}
+	}
+	return location
+}
+
+func (p Problem) Error() string {
+	if location := p.Location(); location != "" {
+		return location + ": " + p.Message
+	}
+	return p.Message
+}
+
+var (
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+	targetPattern   = regexp.MustCompile(`(icmp|http) config at index (\d+)`)
+	indexPatterns   = map[string]*regexp.Regexp{
+		"notifiers":          regexp.MustCompile(`notifier config at index (\d+)`),
+		"routes":             regexp.MustCompile(`route at index (\d+)`),
+		"escalationPolicies": regexp.MustCompile(`escalation policy at index (\d+)`),
+	}
+	namedPatterns = map[string]*regexp.Regexp{
+		"notifiers":          regexp.MustCompile(`notifier (\S+?)( schedule)?: `),
+		"escalationPolicies": regexp.MustCompile(`escalation policy (\S+) step`),
+	}
+)
+
+// LintConfig checks a configuration, a file with its includes or a directory,
+// and returns every problem it finds, sorted by file and line. On top of the
+// checks inframon runs at startup it reports every bad target instead of the
+// first one, malformed URLs and services that are monitored more than once. The
+// error is only set when the configuration cannot be read. The checks run on a
+// configuration that passed all of that, and their errors are placed like those
+// of the startup validation.
+func LintConfig(path string, checks ...func(*Config) error) ([]Problem, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	source, problems := loadSource(path)
+	if source == nil {
+		return problems, nil
+	}
+	// The schema check of the loader already reported the settings it rejects,
+	// so other errors on the same line would repeat them.
+	reported := make(map[string]bool)
+	for _, problem := range problems {
+		reported[fmt.Sprintf("%s:%d", problem.File, problem.Line)] = true
+	}
+
+	config, typeProblems := source.decode()
+	l := &linter{source: source, root: source.document, config: config, seen: make(map[string]bool)}
+	l.validate()
+	l.checkURLs()
+	l.checkServices()
+	if !hasErrors(problems) && !hasErrors(typeProblems) && !hasErrors(l.problems) {
+		for _, check := range checks {
+			if err := check(config); err != nil {
+				l.addError(err.Error())
+			}
+		}
+	}
+	for _, problem := range append(typeProblems, l.problems...) {
+		if problem.Severity == ProblemError && reported[fmt.Sprintf("%s:%d", problem.File, problem.Line)] {
+			continue
+		}
+		problems = append(problems, problem)
+	}
+
+	order := make(map[string]int)
+	for i, file := range source.files {
+		order[file.name] = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return order[problems[i].File] < order[problems[j].File]
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+func hasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == ProblemError {
+			return true
+		}
+	}
+	return false
+}
+
+func yamlProblem(message string) Problem {
+	message = strings.TrimPrefix(message, "yaml: ")
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return Problem{Line: line, Severity: ProblemError, Message: match[2]}
+	}
+	return Problem{Severity: ProblemError, Message: message}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the top level"
+	}
+	return path
+}
+
+type linter struct {
+	source   *configSource
+	root     *yaml.Node
+	config   *Config
+	problems []Problem
+	seen     map[string]bool
+}
+
+// node returns the node at path, made of mapping keys and sequence indexes, or
+// the deepest node found on the way.
+func (l *linter) node(path ...interface{}) *yaml.Node {
+	current := l.root
+	for _, step := range path {
+		var next *yaml.Node
+		switch step := step.(type) {
+		case string:
+			if current.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(current.Content); i += 2 {
+					if current.Content[i].Value == step {
+						next = current.Content[i+1]
+						// Point at the key of a scalar so the column is where the setting starts.
+						if next.Kind == yaml.ScalarNode {
+							next = current.Content[i]
+						}
+						break
+					}
+				}
+			}
+		case int:
+			if current.Kind == yaml.SequenceNode && step < len(current.Content) {
+				next = current.Content[step]
+			}
+		}
+		if next == nil {
+			return current
+		}
+		current = next
+	}
+	return current
+}
+
+func (l *linter) add(node *yaml.Node, severity string, message string) {
+	file := l.source.owner(node)
+	key := fmt.Sprintf("%s:%d:%s", file, node.Line, message)
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.problems = append(l.problems, Problem{File: file, Line: node.Line, Column: node.Column, Severity: severity, Message: message})
+}
+
+// validate runs the startup validation. The target checks run once per target so
+// that every bad target is reported, not only the first.
+func (l *linter) validate() {
+	for i, icmp := range l.config.ICMP {
+		if err := icmp.Validate(i); err != nil {
+			l.addError(err.Error())
+		}
+	}
+	for i, http := range l.config.HTTP {
+		if err := http.Validate(i); err != nil {
+			l.addError(err.Error())
+		}
+	}
+	// ValidateConfiguration stops at its first error, so the notifier checks
+	// after it are run on their own as well.
+	if err := ValidateNotifiersConfig(l.config); err != nil {
+		l.addError(err.Error())
+	}
+	if err := ValidateConfiguration(l.config); err != nil {
+		message := err.Error()
+		message = strings.TrimPrefix(message, "ICMP config validation failed: ")
+		message = strings.TrimPrefix(message, "HTTP config validation failed: ")
+		message = strings.TrimPrefix(message, "notifier config validation failed: ")
+		l.addError(message)
+	}
+}
+
+// addError places a validation error on the line of the setting it names.
+func (l *linter) addError(message string) {
+	// Duplicate targets are already reported while loading, with the files they are in.
+	if strings.Contains(message, "has duplicate address") || strings.Contains(message, "has duplicate id") {
+		return
+	}
+	l.add(l.locate(message), ProblemError, message)
+}
+
+func (l *linter) locate(message string) *yaml.Node {
+	if match := targetPattern.FindStringSubmatch(message); match != nil {
+		index, _ := strconv.Atoi(match[2])
+		return mentionedKey(l.node(match[1], index), message)
+	}
+	for section, pattern := range indexPatterns {
+		if match := pattern.FindStringSubmatch(message); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			return mentionedKey(l.node(section, index), message)
+		}
+	}
+	for section, pattern := range namedPatterns {
+		if match := pattern.FindStringSubmatch(message); match != nil {
+			if index := l.indexByName(section, match[1]); index >= 0 {
+				return mentionedKey(l.node(section, index), message)
+			}
+		}
+	}
+	if strings.HasPrefix(message, "defaultRoute") {
+		return l.node("defaultRoute")
+	}
+	configuration := l.node("configuration")
+	if configuration.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(configuration.Content); i += 2 {
+			key := configuration.Content[i].Value
+			if strings.HasPrefix(message, key+" ") || strings.Contains(message, " "+key+" ") {
+				return configuration.Content[i]
+			}
+		}
+	}
+	return configuration
+}
+
+// mentionedKey returns the key of item, or of a mapping inside it, that message
+// names, or item if it names none of them.
+func mentionedKey(item *yaml.Node, message string) *yaml.Node {
+	if item.Kind != yaml.MappingNode {
+		return item
+	}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		key := item.Content[i]
+		if containsWord(message, key.Value) {
+			return key
+		}
+	}
+	for i := 1; i < len(item.Content); i += 2 {
+		if key := mentionedKey(item.Content[i], message); key != item.Content[i] {
+			return key
+		}
+	}
+	return item
+}
+
+// containsWord reports whether word appears in message, ignoring case, and not
+// as part of a longer word.
+func containsWord(message string, word string) bool {
+	if word == "" {
+		return false
+	}
+	message, word = strings.ToLower(message), strings.ToLower(word)
+	for offset := 0; ; {
+		i := strings.Index(message[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(word)
+		if (start == 0 || !isWordByte(message[start-1])) && (end == len(message) || !isWordByte(message[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+func (l *linter) indexByName(section string, name string) int {
+	switch section {
+	case "notifiers":
+		for i, notifier := range l.config.Notifiers {
+			if notifier.Name == name {
+				return i
+			}
+		}
+	case "escalationPolicies":
+		for i, policy := range l.config.EscalationPolicies {
+			if policy.Name == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// checkURLs checks the syntax of every URL that is set, including those of
+// integrations that are currently disabled.
+func (l *linter) checkURLs() {
+	c := l.config.Configuration
+	urls := map[string]string{
+		"discordWebhookUrl":   c.DiscordWebHookURL,
+		"discordAvatarUrl":    c.DiscordAvatarURL,
+		"pagerDutyUrl":        c.PagerDutyURL,
+		"alertmanagerUrl":     c.AlertmanagerURL,
+		"opsgenieUrl":         c.OpsgenieURL,
+		"webhookUrl":          c.WebhookURL,
+		"matrixHomeserverUrl": c.MatrixHomeserverURL,
+	}
+	for key, value := range urls {
+		l.checkURL(value, key, "configuration", key)
+	}
+	for i, notifier := range l.config.Notifiers {
+		l.checkURL(notifier.URL, fmt.Sprintf("notifier %s url", notifier.Name), "notifiers", i, "url")
+		l.checkURL(notifier.AvatarURL, fmt.Sprintf("notifier %s avatarUrl", notifier.Name), "notifiers", i, "avatarUrl")
+	}
+	for i, http := range l.config.HTTP {
+		l.checkURL(http.Address, fmt.Sprintf("http config at index %d address", i), "http", i, "address")
+	}
+}
+
+func (l *linter) checkURL(value string, name string, path ...interface{}) {
+	// Webhook urls may be templates, which are checked when they are parsed.
+	if value == "" || strings.Contains(value, "{{") {
+		return
+	}
+	if err := validateURL(value); err != nil {
+		l.add(l.node(path...), ProblemError, fmt.Sprintf("%s is invalid: %v", name, err))
+	}
+}
+
+// checkServices warns about a service name that is used by more than one target,
+// which makes notifications for them hard to tell apart.
+func (l *linter) checkServices() {
+	first := make(map[string]string)
+	check := func(protocol string, index int, service string) {
+		if service == "" {
+			return
+		}
+		here := fmt.Sprintf("%s config at index %d", protocol, index)
+		if previous, ok := first[service]; ok {
+			l.add(l.node(protocol, index, "service"), ProblemWarning, fmt.Sprintf("%s has service %q, which is already used by %s", here, service, previous))
+			return
+		}
+		first[service] = here
+	}
+	for i, icmp := range l.config.ICMP {
+		check("icmp", i, icmp.Service)
+	}
+	for i, http := range l.config.HTTP {
+		check("http", i, http.Service)
+	}
+}
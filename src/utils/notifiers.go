@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var notifierTypes = []string{"discord", "smtp", "pagerduty", "alertmanager", "opsgenie", "webhook", "matrix"}
+
+var severities = []string{"critical", "warning", "info"}
+
+// reservedLabels are the target settings that are already sent as labels, so a
+// label cannot take their name.
+var reservedLabels = []string{"alertname", "address", "service", "networkZone", "instanceType", "protocol", "severity"}
+
+var (
+	discordSnowflake = regexp.MustCompile(`^\d+$`)
+	discordMention   = regexp.MustCompile(`^(<@&?\d+>|@everyone|@here)$`)
+	labelName        = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type NotifierConfig struct {
+	Name           string              `yaml:"name"`
+	Type           string              `yaml:"type"`
+	URL            string              `yaml:"url" secret:"true"`
+	SummaryDisable bool                `yaml:"summaryDisable"`
+	RoutingKey     string              `yaml:"routingKey" secret:"true"`
+	APIKey         string              `yaml:"apiKey" secret:"true"`
+	Priority       string              `yaml:"priority"`
+	Method         string              `yaml:"method"`
+	Headers        map[string]string   `yaml:"headers" secret:"true"`
+	Body           string              `yaml:"body"`
+	AccessToken    string              `yaml:"accessToken" secret:"true"`
+	RoomID         string              `yaml:"roomId"`
+	Host           string              `yaml:"host"`
+	Port           string              `yaml:"port"`
+	Username       string              `yaml:"username"`
+	Password       string              `yaml:"password" secret:"true"`
+	From           string              `yaml:"from"`
+	To             string              `yaml:"to"`
+	Cc             string              `yaml:"cc"`
+	Bcc            string              `yaml:"bcc"`
+	TLS            string              `yaml:"tls"`
+	Auth           string              `yaml:"auth"`
+	ThreadID       string              `yaml:"threadId"`
+	AvatarURL      string              `yaml:"avatarUrl"`
+	Mentions       map[string][]string `yaml:"mentions"`
+	EditOnRecovery bool                `yaml:"editOnRecovery"`
+	Schedule       *ScheduleConfig     `yaml:"schedule"`
+}
+
+type ScheduleConfig struct {
+	Timezone            string                 `yaml:"timezone"`
+	Windows             []ScheduleWindowConfig `yaml:"windows"`
+	ImmediateSeverities []string               `yaml:"immediateSeverities"`
+}
+
+type ScheduleWindowConfig struct {
+	Days  []string `yaml:"days"`
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+}
+
+type RouteMatch struct {
+	NetworkZone  string            `yaml:"networkZone"`
+	InstanceType string            `yaml:"instanceType"`
+	Service      string            `yaml:"service"`
+	Protocol     string            `yaml:"protocol"`
+	Severity     string            `yaml:"severity"`
+	Tags         []string          `yaml:"tags"`
+	Labels       map[string]string `yaml:"labels"`
+}
+
+type RouteConfig struct {
+	Match      RouteMatch `yaml:"match"`
+	Notifiers  []string   `yaml:"notifiers"`
+	Continue   bool       `yaml:"continue"`
+	Escalation string     `yaml:"escalation"`
+}
+
+type EscalationPolicyConfig struct {
+	Name  string                 `yaml:"name"`
+	Steps []EscalationStepConfig `yaml:"steps"`
+}
+
+type EscalationStepConfig struct {
+	After     string   `yaml:"after"`
+	Repeat    string   `yaml:"repeat"`
+	Notifiers []string `yaml:"notifiers"`
+}
+
+// ImplicitNotifierNames lists the notifiers configured through the flat
+// `configuration` keys. They are addressable in routes by these names.
+func ImplicitNotifierNames(config *Config) []string {
+	var names []string
+	if !config.Configuration.DiscordWebHookDisable {
+		names = append(names, "discord")
+	}
+	if !config.Configuration.SmtpDisable {
+		names = append(names, "smtp")
+	}
+	if config.Configuration.PagerDutyEnable {
+		names = append(names, "pagerduty")
+	}
+	if config.Configuration.AlertmanagerEnable {
+		names = append(names, "alertmanager")
+	}
+	if config.Configuration.OpsgenieEnable {
+		names = append(names, "opsgenie")
+	}
+	if config.Configuration.WebhookEnable {
+		names = append(names, "webhook")
+	}
+	if config.Configuration.MatrixEnable {
+		names = append(names, "matrix")
+	}
+	return names
+}
+
+func ValidateNotifiersConfig(config *Config) error {
+	names := make(map[string]bool)
+	for _, name := range notifierTypes {
+		names[name] = false
+	}
+	for _, name := range ImplicitNotifierNames(config) {
+		names[name] = true
+	}
+
+	for i, notifier := range config.Notifiers {
+		if notifier.Name == "" {
+			return fmt.Errorf("notifier config at index %d has empty name", i)
+		}
+		if _, exists := names[notifier.Name]; exists {
+			return fmt.Errorf("notifier config at index %d has duplicate or reserved name: %s", i, notifier.Name)
+		}
+		names[notifier.Name] = true
+		if err := validateNotifier(notifier); err != nil {
+			return fmt.Errorf("notifier %s: %v", notifier.Name, err)
+		}
+		if notifier.Schedule != nil {
+			if err := validateSchedule(*notifier.Schedule); err != nil {
+				return fmt.Errorf("notifier %s schedule: %v", notifier.Name, err)
+			}
+		}
+	}
+
+	policies := make(map[string]bool)
+	for i, policy := range config.EscalationPolicies {
+		if policy.Name == "" {
+			return fmt.Errorf("escalation policy at index %d has empty name", i)
+		}
+		if policies[policy.Name] {
+			return fmt.Errorf("escalation policy at index %d has duplicate name: %s", i, policy.Name)
+		}
+		policies[policy.Name] = true
+		if len(policy.Steps) == 0 {
+			return fmt.Errorf("escalation policy %s has no steps", policy.Name)
+		}
+		for j, step := range policy.Steps {
+			if err := validateEscalationStep(step, names); err != nil {
+				return fmt.Errorf("escalation policy %s step %d: %v", policy.Name, j, err)
+			}
+		}
+	}
+
+	for i, route := range config.Routes {
+		if len(route.Notifiers) == 0 && route.Escalation == "" {
+			return fmt.Errorf("route at index %d has no notifiers or escalation", i)
+		}
+		if err := validateRouteNotifiers(route.Notifiers, names); err != nil {
+			return fmt.Errorf("route at index %d: %v", i, err)
+		}
+		if route.Escalation != "" && !policies[route.Escalation] {
+			return fmt.Errorf("route at index %d references unknown escalation policy %s", i, route.Escalation)
+		}
+		if route.Match.Severity != "" && !contains(severities, route.Match.Severity) {
+			return fmt.Errorf("route at index %d has invalid severity %s (should be one of %s)", i, route.Match.Severity, strings.Join(severities, ", "))
+		}
+		if route.Match.Protocol != "" && route.Match.Protocol != "ICMP" && route.Match.Protocol != "HTTP" {
+			return fmt.Errorf("route at index %d has invalid protocol %s (should be ICMP or HTTP)", i, route.Match.Protocol)
+		}
+		if err := validateLabels(route.Match.Labels); err != nil {
+			return fmt.Errorf("route at index %d %v", i, err)
+		}
+	}
+	if err := validateRouteNotifiers(config.DefaultRoute.Notifiers, names); err != nil {
+		return fmt.Errorf("defaultRoute: %v", err)
+	}
+	if config.DefaultRoute.Escalation != "" && !policies[config.DefaultRoute.Escalation] {
+		return fmt.Errorf("defaultRoute references unknown escalation policy %s", config.DefaultRoute.Escalation)
+	}
+	return nil
+}
+
+func validateEscalationStep(step EscalationStepConfig, names map[string]bool) error {
+	if len(step.Notifiers) == 0 {
+		return fmt.Errorf("no notifiers")
+	}
+	if err := validateRouteNotifiers(step.Notifiers, names); err != nil {
+		return err
+	}
+	if step.After != "" {
+		after, err := time.ParseDuration(step.After)
+		if err != nil || after < 0 {
+			return fmt.Errorf("after must be a non-negative duration such as 10m: %s", step.After)
+		}
+	}
+	if step.Repeat != "" {
+		repeat, err := time.ParseDuration(step.Repeat)
+		if err != nil || repeat < time.Minute {
+			return fmt.Errorf("repeat must be a duration of at least 1m: %s", step.Repeat)
+		}
+	}
+	return nil
+}
+
+func validateRouteNotifiers(routeNotifiers []string, names map[string]bool) error {
+	for _, name := range routeNotifiers {
+		enabled, exists := names[name]
+		if !exists {
+			return fmt.Errorf("unknown notifier %s", name)
+		}
+		if !enabled {
+			return fmt.Errorf("notifier %s is not enabled in configuration", name)
+		}
+	}
+	return nil
+}
+
+func validateNotifier(notifier NotifierConfig) error {
+	required := map[string]string{}
+	switch notifier.Type {
+	case "discord", "alertmanager":
+		required["url"] = notifier.URL
+	case "smtp":
+		required["host"] = notifier.Host
+		required["port"] = notifier.Port
+		required["from"] = notifier.From
+		required["to"] = notifier.To
+		if strings.ToLower(notifier.Auth) != "none" {
+			required["username"] = notifier.Username
+			required["password"] = notifier.Password
+		}
+	case "pagerduty":
+		required["routingKey"] = notifier.RoutingKey
+	case "opsgenie":
+		required["apiKey"] = notifier.APIKey
+	case "webhook":
+		required["url"] = notifier.URL
+	case "matrix":
+		required["url"] = notifier.URL
+		required["accessToken"] = notifier.AccessToken
+		required["roomId"] = notifier.RoomID
+	default:
+		return fmt.Errorf("invalid type %q (should be one of %s)", notifier.Type, strings.Join(notifierTypes, ", "))
+	}
+	for field, value := range required {
+		if value == "" {
+			return fmt.Errorf("%s cannot be empty for type %s", field, notifier.Type)
+		}
+	}
+
+	switch notifier.Type {
+	case "discord":
+		if err := validateURL(notifier.URL); err != nil {
+			return fmt.Errorf("url is invalid: %v", err)
+		}
+		if err := validateDiscordOptions(notifier.ThreadID, notifier.AvatarURL, notifier.Mentions); err != nil {
+			return err
+		}
+	case "alertmanager", "matrix":
+		if err := validateURL(notifier.URL); err != nil {
+			return fmt.Errorf("url is invalid: %v", err)
+		}
+	case "pagerduty", "opsgenie":
+		if notifier.URL != "" {
+			if err := validateURL(notifier.URL); err != nil {
+				return fmt.Errorf("url is invalid: %v", err)
+			}
+		}
+		if notifier.Type == "pagerduty" && notifier.Priority != "" {
+			return fmt.Errorf("priority is not supported for type pagerduty")
+		}
+		switch notifier.Priority {
+		case "", "P1", "P2", "P3", "P4", "P5":
+		default:
+			return fmt.Errorf("priority must be one of P1, P2, P3, P4, P5")
+		}
+	case "webhook":
+		switch strings.ToUpper(notifier.Method) {
+		case "", "GET", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return fmt.Errorf("method must be one of GET, POST, PUT, PATCH, DELETE")
+		}
+	case "smtp":
+		if err := validateEmail(notifier.From); err != nil {
+			return fmt.Errorf("from is invalid: %v", err)
+		}
+		for field, list := range map[string]string{"to": notifier.To, "cc": notifier.Cc, "bcc": notifier.Bcc} {
+			if list == "" {
+				continue
+			}
+			if err := validateEmailList(list); err != nil {
+				return fmt.Errorf("%s is invalid: %v", field, err)
+			}
+		}
+		switch strings.ToLower(notifier.TLS) {
+		case "", "none", "starttls", "implicit":
+		default:
+			return fmt.Errorf("tls must be one of none, starttls, implicit")
+		}
+		switch strings.ToLower(notifier.Auth) {
+		case "", "none", "plain", "login", "cram-md5":
+		default:
+			return fmt.Errorf("auth must be one of none, plain, login, cram-md5")
+		}
+		if err := validatePort(notifier.Port); err != nil {
+			return fmt.Errorf("port is invalid: %v", err)
+		}
+	}
+	if notifier.Type == "matrix" && (!strings.HasPrefix(notifier.RoomID, "!") || !strings.Contains(notifier.RoomID, ":")) {
+		return fmt.Errorf("roomId must be a room id in the form !opaque:server")
+	}
+	return nil
+}
+
+func validateTargetRouting(protocol string, index int, severity string, tags []string, labels map[string]string) error {
+	if severity != "" && !contains(severities, severity) {
+		return fmt.Errorf("%s config at index %d has invalid severity %s (should be one of %s)", protocol, index, severity, strings.Join(severities, ", "))
+	}
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%s config at index %d has an empty tag", protocol, index)
+		}
+	}
+	if err := validateLabels(labels); err != nil {
+		return fmt.Errorf("%s config at index %d %v", protocol, index, err)
+	}
+	return nil
+}
+
+func validateLabels(labels map[string]string) error {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !labelName.MatchString(name) {
+			return fmt.Errorf("has invalid label name %q (should be letters, digits and underscores, not starting with a digit)", name)
+		}
+		if contains(reservedLabels, name) {
+			return fmt.Errorf("has reserved label name %s", name)
+		}
+		if strings.TrimSpace(labels[name]) == "" {
+			return fmt.Errorf("has an empty value for label %s", name)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDiscordOptions(threadID string, avatarURL string, mentions map[string][]string) error {
+	if threadID != "" && !discordSnowflake.MatchString(threadID) {
+		return fmt.Errorf("threadId must be a numeric discord id")
+	}
+	if avatarURL != "" {
+		if err := validateURL(avatarURL); err != nil {
+			return fmt.Errorf("avatarUrl is invalid: %v", err)
+		}
+	}
+	for severity, list := range mentions {
+		if !contains(severities, severity) {
+			return fmt.Errorf("mentions has invalid severity %q (should be one of %s)", severity, strings.Join(severities, ", "))
+		}
+		for _, mention := range list {
+			if !discordMention.MatchString(mention) {
+				return fmt.Errorf("mention %q must be <@userid>, <@&roleid>, @here or @everyone", mention)
+			}
+		}
+	}
+	return nil
+}
+
+var scheduleDays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+func validateSchedule(schedule ScheduleConfig) error {
+	if schedule.Timezone != "" {
+		if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %s", schedule.Timezone)
+		}
+	}
+	if len(schedule.Windows) == 0 {
+		return fmt.Errorf("no windows")
+	}
+	for i, window := range schedule.Windows {
+		for _, day := range window.Days {
+			if !contains(scheduleDays, strings.ToLower(day)) {
+				return fmt.Errorf("window %d has invalid day %s (should be one of %s)", i, day, strings.Join(scheduleDays, ", "))
+			}
+		}
+		if !validClock(window.Start) {
+			return fmt.Errorf("window %d has invalid start %q (should be HH:MM)", i, window.Start)
+		}
+		if !validClock(window.End) {
+			return fmt.Errorf("window %d has invalid end %q (should be HH:MM)", i, window.End)
+		}
+		if window.Start == window.End {
+			return fmt.Errorf("window %d starts and ends at the same time", i)
+		}
+	}
+	for _, severity := range schedule.ImmediateSeverities {
+		if !contains(severities, severity) {
+			return fmt.Errorf("invalid immediate severity %s (should be one of %s)", severity, strings.Join(severities, ", "))
+		}
+	}
+	return nil
+}
+
+func validClock(value string) bool {
+	if value == "24:00" {
+		return true
+	}
+	_, err := time.Parse("15:04", value)
+	return err == nil
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+type SecretProvidersConfig struct {
+	Vault *VaultConfig `yaml:"vault"`
+	Age   *AgeConfig   `yaml:"age"`
+}
+
+// VaultConfig authenticates with Token, or with RoleID and SecretID through the
+// AppRole auth method mounted at AppRoleMount.
+type VaultConfig struct {
+	Address      string `yaml:"address"`
+	Namespace    string `yaml:"namespace"`
+	Token        string `yaml:"token" secret:"true"`
+	RoleID       string `yaml:"roleId"`
+	SecretID     string `yaml:"secretId" secret:"true"`
+	AppRoleMount string `yaml:"appRoleMount"`
+}
+
+type AgeConfig struct {
+	Identity string `yaml:"identity" secret:"true"`
+}
+
+// SecretProvider resolves the references of one scheme, such as
+// vault:secret/inframon#smtp_password.
+type SecretProvider interface {
+	Scheme() string
+	Resolve(reference string) (string, error)
+}
+
+// resolveReferences replaces every value of a secret field that is a secret
+// provider reference with the secret it refers to. Secret fields are the ones
+// tagged `secret:"true"`, which are also redacted; other values are left as they
+// are, so free text that happens to start with vault: is not looked up. The
+// secretProviders block itself is left alone. owner returns the file a node was
+// read from.
+func resolveReferences(document *yaml.Node, owner func(*yaml.Node) string) []Problem {
+	if document.Kind != yaml.MappingNode {
+		return nil
+	}
+	var config SecretProvidersConfig
+	var problems []Problem
+	if block := mappingValue(document, "secretProviders"); block != nil {
+		if err := block.Decode(&config); err != nil {
+			return []Problem{nodeProblem(owner(block), block, "secretProviders: %v", strings.TrimPrefix(err.Error(), "yaml: "))}
+		}
+	}
+	fail := func(section string, err error) {
+		block := mappingValue(mappingValue(document, "secretProviders"), section)
+		problems = append(problems, nodeProblem(owner(block), block, "secretProviders.%s: %v", section, err))
+	}
+	providers := make(map[string]SecretProvider)
+	if config.Vault != nil {
+		provider, err := NewVaultProvider(*config.Vault)
+		if err != nil {
+			fail("vault", err)
+		} else {
+			providers[provider.Scheme()] = provider
+		}
+	}
+	if config.Age != nil {
+		provider, err := NewAgeProvider(*config.Age)
+		if err != nil {
+			fail("age", err)
+		} else {
+			providers[provider.Scheme()] = provider
+		}
+	}
+
+	var walk func(node *yaml.Node, t reflect.Type, secret bool)
+	walk = func(node *yaml.Node, t reflect.Type, secret bool) {
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if !secret {
+				return
+			}
+			scheme, reference, ok := secretReference(node.Value)
+			if !ok {
+				return
+			}
+			provider, ok := providers[scheme]
+			if !ok {
+				problems = append(problems, nodeProblem(owner(node), node, "%s reference but secretProviders.%s is not configured", scheme, scheme))
+				return
+			}
+			value, err := provider.Resolve(reference)
+			if err != nil {
+				problems = append(problems, nodeProblem(owner(node), node, "%v", err))
+				return
+			}
+			RegisterSecret(value)
+			node.Value = value
+			node.Tag = "!!str"
+			node.Style = yaml.DoubleQuotedStyle
+		case yaml.MappingNode:
+			var fields map[string]reflect.Type
+			var secrets map[string]bool
+			if t != nil && t.Kind() == reflect.Struct {
+				fields = yamlFields(t)
+				secrets = secretFields(t)
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if node == document && key.Value == "secretProviders" {
+					continue
+				}
+				switch {
+				case fields != nil:
+					walk(value, fields[key.Value], secrets[key.Value])
+				case t != nil && t.Kind() == reflect.Map:
+					walk(value, t.Elem(), secret)
+				}
+			}
+		case yaml.SequenceNode:
+			var elem reflect.Type
+			if t != nil && t.Kind() == reflect.Slice {
+				elem = t.Elem()
+			}
+			for _, item := range node.Content {
+				walk(item, elem, secret)
+			}
+		}
+	}
+	walk(document, reflect.TypeOf(Config{}), false)
+	return problems
+}
+
+// secretReference splits a value into the scheme and reference of a secret
+// provider. An armored age message needs no prefix.
+func secretReference(value string) (string, string, bool) {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, armor.Header) {
+		return "age", trimmed, true
+	}
+	for _, scheme := range []string{"vault", "age"} {
+		if strings.HasPrefix(trimmed, scheme+":") {
+			return scheme, strings.TrimPrefix(trimmed, scheme+":"), true
+		}
+	}
+	return "", "", false
+}
+
+// AgeProvider decrypts values encrypted to an age identity, either armored or as
+// base64 of the binary format.
+type AgeProvider struct {
+	identities []age.Identity
+}
+
+func NewAgeProvider(config AgeConfig) (*AgeProvider, error) {
+	if strings.TrimSpace(config.Identity) == "" {
+		return nil, fmt.Errorf("identity cannot be empty")
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(config.Identity))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &AgeProvider{identities: identities}, nil
+}
+
+func (p *AgeProvider) Scheme() string { return "age" }
+
+func (p *AgeProvider) Resolve(reference string) (string, error) {
+	var ciphertext io.Reader
+	if strings.HasPrefix(reference, armor.Header) {
+		ciphertext = armor.NewReader(strings.NewReader(reference))
+	} else {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(reference), ""))
+		if err != nil {
+			return "", fmt.Errorf("age value is neither armored nor base64: %w", err)
+		}
+		ciphertext = bytes.NewReader(data)
+	}
+	plaintext, err := age.Decrypt(ciphertext, p.identities...)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt age value: %w", err)
+	}
+	data, err := io.ReadAll(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt age value: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaURL is where the schema of the configuration file is published.
+const SchemaURL = "https://raw.githubusercontent.com/somememoryspace/inframon/main/config/inframon.schema.json"
+
+// Schema is the subset of JSON Schema (draft-07) that describes the
+// configuration file.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+
+	format string
+}
+
+// schemaRule adds what the Go type of a setting does not say. Rules are looked
+// up by "Type.key" first, then by key, so a key can mean different things in
+// different sections.
+type schemaRule struct {
+	description string
+	enum        []string
+	pattern     string
+	minimum     *int
+	maximum     *int
+	types       []string
+	// format describes pattern to people.
+	format string
+}
+
+func atLeast(n int) *int { return &n }
+
+func atMost(n int) *int { return &n }
+
+// envPattern matches values that are only known once ${VAR} references are
+// expanded, so that editors accept them for numbers and booleans.
+const envPattern = `\$\{`
+
+var schemaRules = map[string]schemaRule{
+	"Config.icmp":          {description: "Hosts monitored with ICMP echo requests."},
+	"Config.http":          {description: "URLs monitored with HTTP requests."},
+	"Config.configuration": {description: "Logging, scheduled reports and the built-in notification integrations."},
+	"Config.notifiers":     {description: "Named notifiers that routes and escalation policies send to."},
+	"Config.routes":        {description: "Rules that select the notifiers of a target. The first matching route wins unless it sets continue."},
+	"Config.defaultRoute":  {description: "The notifiers of targets that no route matches."},
+	"Config.escalationPolicies": {
+		description: "Steps that re-notify or escalate while a target stays down.",
+	},
+	"Config.secretProviders": {description: "Vault and age settings for vault:<mount>/<path>#<key> and age: references in secret settings."},
+	"Config.include":         {description: "Files or globs to load along with this file, relative to it."},
+	"Config.defaults":        {description: "Settings every ICMP or HTTP target starts from."},
+	"Config.templates":       {description: "Named sets of target settings that targets select with template."},
+
+	"id":                  {description: "Stable id of the target. Defaults to a hash of the protocol and address.", pattern: targetIDPattern.String(), format: "letters, digits, dots, dashes and underscores"},
+	"TargetMeta.address":  {description: "Host name or IP address for ICMP, URL for HTTP."},
+	"TargetMeta.service":  {description: "Name of the service shown in notifications."},
+	"timeout":             {description: "Seconds between two probes, at most a day.", minimum: atLeast(1), maximum: atMost(86400)},
+	"failureTimeout":      {description: "Seconds a probe may take before it fails, at most 5 minutes.", minimum: atLeast(1), maximum: atMost(300)},
+	"retryBuffer":         {description: "Number of retries before a probe counts as failed, at most 10.", minimum: atLeast(0), maximum: atMost(10)},
+	"skipVerify":          {description: "Skip TLS certificate verification."},
+	"networkZone":         {description: "Network zone of the target, such as DMZ or LAN."},
+	"instanceType":        {description: "Kind of machine of the target, such as VM or LXC."},
+	"pagerDutyRoutingKey": {description: "PagerDuty integration key."},
+	"runbookUrl":          {description: "Link to the runbook of the target, shown in notifications."},
+	"severity":            {description: "Severity of an outage of the target.", enum: severities},
+	"tags":                {description: "Free-form tags."},
+	"labels":              {description: "Free-form name: value labels."},
+	"template":            {description: "Name of a template to take unset settings from."},
+
+	"logFileDirectory":         {description: "Directory of the log file when stdOut is false."},
+	"logFileName":              {description: "Name of the log file when stdOut is false."},
+	"stdOut":                   {description: "Log to standard output instead of a file."},
+	"logFileSize":              {description: "Size at which the log file is rotated, in KB or MB.", pattern: `^\s*([0-9]+\.?[0-9]*|\.[0-9]+)[KkMm][Bb]\s*$`, format: "a size in KB or MB, such as 10MB"},
+	"maxLogFileKeep":           {description: "Number of rotated log files to keep.", minimum: atLeast(0)},
+	"healthCron":               {description: "Cron expression of the scheduled status summary."},
+	"healthCronDisable":        {description: "Disable the scheduled status summary."},
+	"healthCronWebhookDisable": {description: "Do not send the scheduled status summary to Discord."},
+	"healthCronSmtpDisable":    {description: "Do not send the scheduled status summary by email."},
+	"healthCheckTimeout":       {description: "Seconds between two health log lines.", minimum: atLeast(1)},
+	"discordWebhookDisable":    {description: "Disable the Discord integration."},
+	"discordWebhookUrl":        {description: "Discord webhook URL."},
+	"discordThreadId":          {description: "Thread or forum post to post into."},
+	"discordUsername":          {description: "Name the webhook posts with."},
+	"discordAvatarUrl":         {description: "Avatar the webhook posts with."},
+	"discordMentions":          {description: "Roles and users to ping per severity."},
+	"discordEditOnRecovery":    {description: "Edit the alert message when the target recovers."},
+	"smtpDisable":              {description: "Disable the SMTP integration."},
+	"smtpHost":                 {description: "SMTP server host."},
+	"smtpPort":                 {description: "SMTP server port.", pattern: `^[0-9]{1,5}$`, format: "a port number", types: []string{"string", "integer"}},
+	"smtpUsername":             {description: "SMTP user name."},
+	"smtpPassword":             {description: "SMTP password."},
+	"smtpFrom":                 {description: "Sender address."},
+	"smtpTo":                   {description: "Comma separated recipient addresses."},
+	"smtpCc":                   {description: "Comma separated Cc addresses."},
+	"smtpBcc":                  {description: "Comma separated Bcc addresses."},
+	"smtpTls":                  {description: "How the SMTP connection is secured.", enum: []string{"none", "starttls", "implicit"}},
+	"smtpAuth":                 {description: "SMTP authentication mechanism.", enum: []string{"none", "plain", "login", "cram-md5"}},
+	"pagerDutyEnable":          {description: "Enable the PagerDuty integration."},
+	"pagerDutyUrl":             {description: "PagerDuty Events API base URL."},
+	"alertmanagerEnable":       {description: "Enable the Alertmanager integration."},
+	"alertmanagerUrl":          {description: "Alertmanager base URL."},
+	"opsgenieEnable":           {description: "Enable the Opsgenie integration."},
+	"opsgenieApiKey":           {description: "Opsgenie API key."},
+	"opsgenieUrl":              {description: "Opsgenie API base URL."},
+	"opsgeniePriority":         {description: "Priority of Opsgenie alerts.", enum: []string{"P1", "P2", "P3", "P4", "P5"}},
+	"webhookEnable":            {description: "Enable the generic webhook integration."},
+	"webhookUrl":               {description: "Webhook URL, which may be a template."},
+	"webhookMethod":            {description: "HTTP method of the webhook.", enum: []string{"GET", "POST", "PUT", "PATCH", "DELETE"}},
+	"webhookHeaders":           {description: "Headers sent with the webhook."},
+	"webhookBody":              {description: "Template of the webhook body."},
+	"matrixEnable":             {description: "Enable the Matrix integration."},
+	"matrixHomeserverUrl":      {description: "Matrix homeserver URL."},
+	"matrixAccessToken":        {description: "Access token of the Matrix bot account."},
+	"matrixRoomId":             {description: "Internal id of the Matrix room, !opaque:server."},
+	"templates":                {description: "Files of custom notification templates."},
+	"stateDirectory":           {description: "Directory for silences, the notification queue and held notifications."},
+	"apiEnable":                {description: "Serve the HTTP API."},
+	"apiListen":                {description: "Address the HTTP API listens on."},
+	"apiToken":                 {description: "Bearer token the HTTP API requires."},
+	"digestWindow":             {description: "Seconds to group transitions into one digest. 0 disables digests.", minimum: atLeast(0)},
+	"digestMaxEvents":          {description: "Maximum number of transitions in one digest.", minimum: atLeast(0)},
+	"queueMaxAttempts":         {description: "Delivery attempts before a notification is dropped.", minimum: atLeast(0)},
+	"statusSocket":             {description: "Path of the status socket."},
+	"statusSocketDisable":      {description: "Disable the status socket."},
+
+	"NotifierConfig.name": {description: "Name routes and escalation policies refer to."},
+	"NotifierConfig.type": {description: "Kind of notifier.", enum: notifierTypes},
+	"NotifierConfig.url":  {description: "Webhook URL, or the API base URL of PagerDuty, Alertmanager, Opsgenie or the Matrix homeserver."},
+	"summaryDisable":      {description: "Do not send scheduled status summaries to this notifier."},
+	"routingKey":          {description: "PagerDuty integration key."},
+	"apiKey":              {description: "Opsgenie API key."},
+	"priority":            {description: "Priority of Opsgenie alerts.", enum: []string{"P1", "P2", "P3", "P4", "P5"}},
+	"method":              {description: "HTTP method of the webhook.", enum: []string{"GET", "POST", "PUT", "PATCH", "DELETE"}},
+	"headers":             {description: "Headers sent with the webhook."},
+	"body":                {description: "Template of the webhook body."},
+	"accessToken":         {description: "Access token of the Matrix bot account."},
+	"roomId":              {description: "Internal id of the Matrix room, !opaque:server."},
+	"host":                {description: "SMTP server host."},
+	"port":                {description: "SMTP server port.", pattern: `^[0-9]{1,5}$`, format: "a port number", types: []string{"string", "integer"}},
+	"username":            {description: "SMTP user name."},
+	"password":            {description: "SMTP password."},
+	"from":                {description: "Sender address."},
+	"to":                  {description: "Comma separated recipient addresses."},
+	"cc":                  {description: "Comma separated Cc addresses."},
+	"bcc":                 {description: "Comma separated Bcc addresses."},
+	"tls":                 {description: "How the SMTP connection is secured.", enum: []string{"none", "starttls", "implicit"}},
+	"auth":                {description: "SMTP authentication mechanism.", enum: []string{"none", "plain", "login", "cram-md5"}},
+	"threadId":            {description: "Discord thread or forum post to post into."},
+	"avatarUrl":           {description: "Avatar the Discord webhook posts with."},
+	"mentions":            {description: "Discord roles and users to ping per severity."},
+	"editOnRecovery":      {description: "Edit the Discord alert message when the target recovers."},
+	"schedule":            {description: "Delivery windows outside of which non-critical alerts are held."},
+	"timezone":            {description: "IANA time zone of the windows."},
+	"windows":             {description: "Times at which notifications are delivered."},
+	"immediateSeverities": {description: "Severities delivered outside the windows too.", enum: severities},
+	"days":                {description: "Days the window applies to. Every day if empty.", enum: scheduleDays},
+	"start":               {description: "Start of the window, HH:MM.", pattern: `^(([01]?[0-9]|2[0-3]):[0-5][0-9]|24:00)$`, format: "a time as HH:MM"},
+	"end":                 {description: "End of the window, HH:MM. 24:00 is the end of the day.", pattern: `^(([01]?[0-9]|2[0-3]):[0-5][0-9]|24:00)$`, format: "a time as HH:MM"},
+	"match":               {description: "Conditions a target must meet. Empty conditions match everything."},
+	"RouteMatch.service":  {description: "Service of the target."},
+	"RouteMatch.protocol": {description: "Protocol of the target.", enum: []string{"ICMP", "HTTP"}},
+	"RouteMatch.tags":     {description: "Tags the target must all have."},
+	"RouteMatch.labels":   {description: "Labels the target must all have."},
+	"notifiers":           {description: "Names of the notifiers to send to."},
+	"continue":            {description: "Also try the routes after this one."},
+	"escalation":          {description: "Name of the escalation policy of the matched targets."},
+	"EscalationPolicyConfig.name": {
+		description: "Name routes refer to with escalation.",
+	},
+	"steps":                     {description: "Steps in the order they fire."},
+	"after":                     {description: "How long the target must be down before the step fires, such as 10m."},
+	"repeat":                    {description: "Interval at which the step fires again, at least 1m."},
+	"vault":                     {description: "HashiCorp Vault KV v2 provider."},
+	"age":                       {description: "age decryption provider."},
+	"VaultConfig.address":       {description: "Vault address. Defaults to VAULT_ADDR."},
+	"namespace":                 {description: "Vault Enterprise namespace."},
+	"token":                     {description: "Vault token. Defaults to VAULT_TOKEN."},
+	"roleId":                    {description: "AppRole role id."},
+	"secretId":                  {description: "AppRole secret id."},
+	"appRoleMount":              {description: "Mount of the AppRole auth method."},
+	"identity":                  {description: "age identity to decrypt values with."},
+	"TargetDefaults.icmp":       {description: "Defaults of ICMP targets."},
+	"TargetDefaults.http":       {description: "Defaults of HTTP targets."},
+	"TargetTemplate.skipVerify": {description: "Skip TLS certificate verification. Only applies to HTTP targets."},
+}
+
+// ConfigSchema returns the JSON Schema of the configuration file, derived from
+// the Config type.
+func ConfigSchema() *Schema {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.ID = SchemaURL
+	schema.Title = "Inframon configuration"
+	return schema
+}
+
+// SchemaJSON returns ConfigSchema as indented JSON.
+func SchemaJSON() ([]byte, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	// Descriptions such as vault:<mount>/<path> stay readable in editors.
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ConfigSchema()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+		for _, field := range schemaFields(t) {
+			property := schemaFor(field.typ)
+			applyRule(property, field.owner, field.name)
+			schema.Properties[field.name] = property
+			if field.typ.Kind() == reflect.String {
+				schema.Properties[field.name+SecretFileSuffix] = &Schema{Type: "string", Description: fmt.Sprintf("File to read %s from.", field.name)}
+			}
+		}
+		return schema
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Int:
+		return &Schema{AnyOf: []*Schema{{Type: "integer"}, {Type: "string", Pattern: envPattern}}}
+	case reflect.Bool:
+		return &Schema{AnyOf: []*Schema{{Type: "boolean"}, {Type: "string", Pattern: envPattern}}}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+func applyRule(schema *Schema, owner string, name string) {
+	rule, ok := schemaRules[owner+"."+name]
+	if !ok {
+		rule = schemaRules[name]
+	}
+	schema.Description = rule.description
+	target := schema
+	if len(schema.AnyOf) > 0 {
+		target = schema.AnyOf[0]
+	}
+	if schema.Type == "array" {
+		target = schema.Items
+	}
+	target.Enum = rule.enum
+	target.Pattern = rule.pattern
+	target.format = rule.format
+	target.Minimum = rule.minimum
+	target.Maximum = rule.maximum
+	if rule.types != nil {
+		target.Type = rule.types
+	}
+}
+
+type schemaField struct {
+	name  string
+	owner string
+	typ   reflect.Type
+}
+
+// schemaFields lists the yaml fields of t with the name of the type that
+// declares them, which is the embedded type for inlined fields.
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			fields = append(fields, schemaFields(t.Field(i).Type)...)
+			continue
+		}
+		if tag[0] != "" && tag[0] != "-" {
+			fields = append(fields, schemaField{name: tag[0], owner: t.Name(), typ: t.Field(i).Type})
+		}
+	}
+	return fields
+}
+
+var configSchema = ConfigSchema()
+
+// check validates a configuration file against the schema. Enums are compared
+// without case, like inframon reads those settings. Values that are not set
+// are left to the checks that know their defaults.
+func (s *Schema) check(node *yaml.Node, path string, file string, problems *[]Problem) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return
+	}
+	if len(s.AnyOf) > 0 {
+		var first []Problem
+		for i, option := range s.AnyOf {
+			var optionProblems []Problem
+			option.check(node, path, file, &optionProblems)
+			if len(optionProblems) == 0 {
+				return
+			}
+			if i == 0 {
+				first = optionProblems
+			}
+		}
+		*problems = append(*problems, first...)
+		return
+	}
+	if !s.matchesType(node) {
+		*problems = append(*problems, nodeProblem(file, node, "%s must be %s", describePath(path), s.typeName()))
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			property, ok := s.Properties[key.Value]
+			if !ok {
+				property, ok = s.AdditionalProperties.(*Schema)
+			}
+			if !ok {
+				*problems = append(*problems, nodeProblem(file, key, "unknown key %q in %s", key.Value, describePath(path)))
+				continue
+			}
+			property.check(value, joinPath(path, key.Value), file, problems)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			s.Items.check(item, fmt.Sprintf("%s[%d]", path, i), file, problems)
+		}
+	case yaml.ScalarNode:
+		s.checkScalar(node, path, file, problems)
+	}
+}
+
+func (s *Schema) checkScalar(node *yaml.Node, path string, file string, problems *[]Problem) {
+	if len(s.Enum) > 0 && node.Value != "" && !containsFold(s.Enum, node.Value) {
+		*problems = append(*problems, nodeProblem(file, node, "%s must be one of %s", describePath(path), strings.Join(s.Enum, ", ")))
+	}
+	if s.Pattern != "" && node.Value != "" && !regexp.MustCompile(s.Pattern).MatchString(node.Value) {
+		*problems = append(*problems, nodeProblem(file, node, "%s must be %s", describePath(path), s.format))
+	}
+	if (s.Minimum != nil || s.Maximum != nil) && node.ShortTag() == "!!int" {
+		var value int
+		if err := node.Decode(&value); err != nil {
+			return
+		}
+		if s.Minimum != nil && value < *s.Minimum {
+			*problems = append(*problems, nodeProblem(file, node, "%s must be at least %d", describePath(path), *s.Minimum))
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			*problems = append(*problems, nodeProblem(file, node, "%s must be at most %d", describePath(path), *s.Maximum))
+		}
+	}
+}
+
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(node *yaml.Node) bool {
+	for _, t := range s.types() {
+		switch t {
+		case "object":
+			if node.Kind == yaml.MappingNode {
+				return true
+			}
+		case "array":
+			if node.Kind == yaml.SequenceNode {
+				return true
+			}
+		case "integer":
+			if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!int" {
+				return true
+			}
+		case "boolean":
+			if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!bool" {
+				return true
+			}
+		case "string":
+			// Like the decoder, accept any scalar for text settings.
+			if node.Kind == yaml.ScalarNode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Schema) typeName() string {
+	names := map[string]string{"object": "a mapping", "array": "a list", "integer": "a whole number", "boolean": "true or false", "string": "text"}
+	var described []string
+	for _, t := range s.types() {
+		described = append(described, names[t])
+	}
+	sort.Strings(described)
+	return strings.Join(described, " or ")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SecretFileSuffix turns any string setting into one read from a file, e.g.
+	// smtpPasswordFile: /run/secrets/smtp sets smtpPassword.
+	SecretFileSuffix = "File"
+	Redacted         = "[REDACTED]"
+	// minSecretLength keeps very short values from being redacted everywhere they
+	// happen to appear in a message.
+	minSecretLength = 4
+)
+
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+var redactor = struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{values: make(map[string]bool)}
+
+// RegisterSecret makes Redact hide value from now on.
+func RegisterSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecretLength {
+		return
+	}
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	if redactor.values[value] {
+		return
+	}
+	redactor.values[value] = true
+	values := make([]string, 0, len(redactor.values))
+	for v := range redactor.values {
+		values = append(values, v)
+	}
+	// Longer values first, so a secret containing another is hidden as a whole.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	redactor.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces every registered secret in text.
+func Redact(text string) string {
+	redactor.mu.RLock()
+	defer redactor.mu.RUnlock()
+	if redactor.replacer == nil {
+		return text
+	}
+	return redactor.replacer.Replace(text)
+}
+
+// RedactWriter redacts everything written through it, for loggers that are not
+// a SafeLogger.
+type RedactWriter struct {
+	Writer io.Writer
+}
+
+func (w RedactWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// resolveNode expands environment variables in every value of a file and
+// replaces every <key>File setting of a string field with the content of the
+// file, relative to the file that sets it. Values read from files are always
+// secrets.
+func resolveNode(node *yaml.Node, t reflect.Type, file string, problems *[]Problem) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		expandScalar(node, file, problems)
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		for _, item := range node.Content {
+			resolveNode(item, elem, file, problems)
+		}
+	case yaml.MappingNode:
+		var fields map[string]reflect.Type
+		if t != nil && t.Kind() == reflect.Struct {
+			fields = yamlFields(t)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			var field reflect.Type
+			switch {
+			case fields != nil:
+				field = fields[key.Value]
+			case t != nil && t.Kind() == reflect.Map:
+				field = t.Elem()
+			}
+			resolveNode(value, field, file, problems)
+			if fields == nil || field != nil || !isSecretFileKey(fields, key.Value) {
+				continue
+			}
+			name := strings.TrimSuffix(key.Value, SecretFileSuffix)
+			if hasKey(node, name) {
+				*problems = append(*problems, nodeProblem(file, key, "%s and %s cannot both be set", name, key.Value))
+				continue
+			}
+			readSecretFile(key, value, name, file, problems)
+		}
+	}
+}
+
+// expandScalar replaces ${VAR} and ${VAR:-default} with the environment variable.
+// $${ is a literal ${.
+func expandScalar(node *yaml.Node, file string, problems *[]Problem) {
+	if !strings.Contains(node.Value, "${") {
+		return
+	}
+	expanded := envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+		if reference == "$${" {
+			return "${"
+		}
+		match := envReference.FindStringSubmatch(reference)
+		if value, ok := os.LookupEnv(match[1]); ok && value != "" {
+			return value
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		*problems = append(*problems, nodeProblem(file, node, "environment variable %s is not set", match[1]))
+		return reference
+	})
+	node.Value = expanded
+	// A plain value is typed again after expansion, so ${TIMEOUT} can fill an int.
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+}
+
+func readSecretFile(key *yaml.Node, value *yaml.Node, name string, file string, problems *[]Problem) {
+	path := value.Value
+	if path == "" {
+		*problems = append(*problems, nodeProblem(file, value, "%s cannot be empty", key.Value))
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		*problems = append(*problems, nodeProblem(file, value, "%s could not be read: %v", key.Value, err))
+		return
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	RegisterSecret(secret)
+	key.Value = name
+	value.Value = secret
+	value.Tag = "!!str"
+	value.Style = yaml.DoubleQuotedStyle
+}
+
+// isSecretFileKey reports whether key is the <key>File variant of a string field.
+func isSecretFileKey(fields map[string]reflect.Type, key string) bool {
+	if !strings.HasSuffix(key, SecretFileSuffix) {
+		return false
+	}
+	field, ok := fields[strings.TrimSuffix(key, SecretFileSuffix)]
+	return ok && field.Kind() == reflect.String
+}
+
+func hasKey(node *yaml.Node, name string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			for name, field := range yamlFields(t.Field(i).Type) {
+				fields[name] = field
+			}
+			continue
+		}
+		if tag[0] != "" && tag[0] != "-" {
+			fields[tag[0]] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// secretFields returns the names of the yaml fields of t tagged `secret:"true"`.
+func secretFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			for name := range secretFields(t.Field(i).Type) {
+				fields[name] = true
+			}
+			continue
+		}
+		if tag[0] != "" && tag[0] != "-" && t.Field(i).Tag.Get("secret") == "true" {
+			fields[tag[0]] = true
+		}
+	}
+	return fields
+}
+
+// registerSecrets registers the values of every field tagged `secret:"true"`.
+func registerSecrets(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			registerSecrets(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			registerSecrets(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if v.Type().Field(i).Tag.Get("secret") != "true" {
+				registerSecrets(field)
+				continue
+			}
+			switch field.Kind() {
+			case reflect.String:
+				RegisterSecret(field.String())
+			case reflect.Map:
+				for _, key := range field.MapKeys() {
+					if value := field.MapIndex(key); value.Kind() == reflect.String {
+						RegisterSecret(value.String())
+					}
+				}
+			}
+		}
+	}
+}
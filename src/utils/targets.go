@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var targetIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// TargetMeta holds the settings every target has, whatever its protocol.
+type TargetMeta struct {
+	ID                  string            `yaml:"id"`
+	Address             string            `yaml:"address"`
+	Service             string            `yaml:"service"`
+	Timeout             int               `yaml:"timeout"`
+	FailureTimeout      int               `yaml:"failureTimeout"`
+	RetryBuffer         int               `yaml:"retryBuffer"`
+	NetworkZone         string            `yaml:"networkZone"`
+	InstanceType        string            `yaml:"instanceType"`
+	PagerDutyRoutingKey string            `yaml:"pagerDutyRoutingKey" secret:"true"`
+	RunbookURL          string            `yaml:"runbookUrl"`
+	Severity            string            `yaml:"severity"`
+	Tags                []string          `yaml:"tags"`
+	Labels              map[string]string `yaml:"labels"`
+	Template            string            `yaml:"template"`
+}
+
+// ICMPTarget is a host that is pinged.
+type ICMPTarget struct {
+	TargetMeta `yaml:",inline"`
+}
+
+// HTTPTarget is a URL that is requested.
+type HTTPTarget struct {
+	TargetMeta `yaml:",inline"`
+	SkipVerify bool `yaml:"skipVerify"`
+}
+
+func (t ICMPTarget) Protocol() string { return "ICMP" }
+
+func (t HTTPTarget) Protocol() string { return "HTTP" }
+
+// Validate checks the settings of the target, which is at index in the icmp list.
+// Duplicate ids are checked by ValidateICMPConfig.
+func (t ICMPTarget) Validate(index int) error {
+	if err := t.validate("icmp", index); err != nil {
+		return err
+	}
+	if err := validateNumericField("icmp", "timeout", t.Timeout, 1, index); err != nil {
+		return err
+	}
+	if err := validateNumericField("icmp", "failureTimeout", t.FailureTimeout, 1, index); err != nil {
+		return err
+	}
+	if err := validateNumericField("icmp", "retryBuffer", t.RetryBuffer, 0, index); err != nil {
+		return err
+	}
+	return t.validateLinks("icmp", index)
+}
+
+// Validate checks the settings of the target, which is at index in the http list.
+// Duplicate ids are checked by ValidateHTTPConfig.
+func (t HTTPTarget) Validate(index int) error {
+	if err := t.validate("http", index); err != nil {
+		return err
+	}
+	if err := validateNumericField("http", "timeout", t.Timeout, 1, index); err != nil {
+		return err
+	}
+	if err := validateNumericField("http", "failureTimeout", t.FailureTimeout, 1, index); err != nil {
+		return err
+	}
+	if err := validateNumericField("http", "retryBuffer", t.RetryBuffer, 0, index); err != nil {
+		return err
+	}
+	return t.validateLinks("http", index)
+}
+
+func (t TargetMeta) validate(protocol string, index int) error {
+	required := []struct{ field, value string }{
+		{"address", t.Address},
+		{"service", t.Service},
+		{"networkZone", t.NetworkZone},
+		{"instanceType", t.InstanceType},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return fmt.Errorf("%s config at index %d has empty %s", protocol, index, r.field)
+		}
+	}
+	if t.ID != "" && t.ID != TargetID(protocol, t.Address) && !targetIDPattern.MatchString(t.ID) {
+		return fmt.Errorf("%s config at index %d has invalid id %q (should be letters, digits, dots, dashes and underscores)", protocol, index, t.ID)
+	}
+	return nil
+}
+
+func (t TargetMeta) validateLinks(protocol string, index int) error {
+	if t.RunbookURL != "" {
+		if err := validateURL(t.RunbookURL); err != nil {
+			return fmt.Errorf("%s config at index %d has invalid runbookUrl: %v", protocol, index, err)
+		}
+	}
+	return validateTargetRouting(protocol, index, t.Severity, t.Tags, t.Labels)
+}
+
+// Validate runs every check inframon runs on a configuration at startup.
+func (c *Config) Validate() error {
+	return ValidateConfiguration(c)
+}
+
+// TargetID is the id of a target that does not set one. It only depends on the
+// protocol and address, so it stays the same when other settings change.
+func TargetID(protocol string, address string) string {
+	protocol = strings.ToLower(protocol)
+	sum := sha256.Sum256([]byte(protocol + "\x00" + address))
+	return protocol + "-" + hex.EncodeToString(sum[:6])
+}
+
+// AssignTargetIDs gives every target without an id its TargetID. LoadConfig does
+// this itself; a Config built in Go needs it before it is used.
+func (c *Config) AssignTargetIDs() {
+	for i := range c.ICMP {
+		if c.ICMP[i].ID == "" {
+			c.ICMP[i].ID = TargetID(c.ICMP[i].Protocol(), c.ICMP[i].Address)
+		}
+	}
+	for i := range c.HTTP {
+		if c.HTTP[i].ID == "" {
+			c.HTTP[i].ID = TargetID(c.HTTP[i].Protocol(), c.HTTP[i].Address)
+		}
+	}
+}
+
+// validateTargetID checks the id of the target at index against the ids seen so
+// far. Without an explicit id, a duplicate is the same address monitored twice.
+func validateTargetID(protocol string, index int, id string, address string, seen map[string]bool) error {
+	explicit := id != "" && id != TargetID(protocol, address)
+	if id == "" {
+		id = TargetID(protocol, address)
+	}
+	if seen[id] {
+		if !explicit {
+			return fmt.Errorf("%s config at index %d has duplicate address: %s (set id to monitor it more than once)", protocol, index, address)
+		}
+		return fmt.Errorf("%s config at index %d has duplicate id: %s", protocol, index, id)
+	}
+	seen[id] = true
+	return nil
+}
+
+// validateTargetIDs checks that ids are unique across protocols.
+func validateTargetIDs(config *Config) error {
+	seen := make(map[string]bool)
+	for i, icmp := range config.ICMP {
+		if err := validateTargetID("icmp", i, icmp.ID, icmp.Address, seen); err != nil {
+			return err
+		}
+	}
+	for i, http := range config.HTTP {
+		if err := validateTargetID("http", i, http.ID, http.Address, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
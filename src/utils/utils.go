@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"gopkg.in/yaml.v2"
 	"log"
+	"net"
 	"net/mail"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,48 +21,76 @@ import (
 const loggerFlags = log.Ldate | log.Ltime | log.Lshortfile
 
 type Config struct {
-	ICMP []struct {
-		Address        string `yaml:"address"`
-		Service        string `yaml:"service"`
-		Timeout        int    `yaml:"timeout"`
-		FailureTimeout int    `yaml:"failureTimeout"`
-		RetryBuffer    int    `yaml:"retryBuffer"`
-		NetworkZone    string `yaml:"networkZone"`
-		InstanceType   string `yaml:"instanceType"`
-	} `yaml:"icmp"`
-
-	HTTP []struct {
-		Address        string `yaml:"address"`
-		Service        string `yaml:"service"`
-		Timeout        int    `yaml:"timeout"`
-		FailureTimeout int    `yaml:"failureTimeout"`
-		SkipVerify     bool   `yaml:"skipVerify"`
-		RetryBuffer    int    `yaml:"retryBuffer"`
-		NetworkZone    string `yaml:"networkZone"`
-		InstanceType   string `yaml:"instanceType"`
-	} `yaml:"http"`
+	ICMP []ICMPTarget `yaml:"icmp"`
+	HTTP []HTTPTarget `yaml:"http"`
 
 	Configuration struct {
-		LogFileDirectory         string `yaml:"logFileDirectory"`
-		LogFileName              string `yaml:"logFileName"`
-		Stdout                   bool   `yaml:"stdOut"`
-		HealthCron               string `yaml:"healthCron"`
-		HealthCronDisable        bool   `yaml:"healthCronDisable"`
-		HealthCronWebhookDisable bool   `yaml:"healthCronWebhookDisable"`
-		HealthCronSmtpDisable    bool   `yaml:"healthCronSmtpDisable"`
-		HealthCheckTimeout       int    `yaml:"healthCheckTimeout"`
-		DiscordWebHookDisable    bool   `yaml:"discordWebhookDisable"`
-		DiscordWebHookURL        string `yaml:"discordWebhookUrl"`
-		LogFileSize              string `yaml:"logFileSize"`
-		MaxLogFileKeep           int    `yaml:"maxLogFileKeep"`
-		SmtpDisable              bool   `yaml:"smtpDisable"`
-		SmtpHost                 string `yaml:"smtpHost"`
-		SmtpPort                 string `yaml:"smtpPort"`
-		SmtpUsername             string `yaml:"smtpUsername"`
-		SmtpPassword             string `yaml:"smtpPassword"`
-		SmtpFrom                 string `yaml:"smtpFrom"`
-		SmtpTo                   string `yaml:"smtpTo"`
+		LogFileDirectory         string              `yaml:"logFileDirectory"`
+		LogFileName              string              `yaml:"logFileName"`
+		Stdout                   bool                `yaml:"stdOut"`
+		HealthCron               string              `yaml:"healthCron"`
+		HealthCronDisable        bool                `yaml:"healthCronDisable"`
+		HealthCronWebhookDisable bool                `yaml:"healthCronWebhookDisable"`
+		HealthCronSmtpDisable    bool                `yaml:"healthCronSmtpDisable"`
+		HealthCheckTimeout       int                 `yaml:"healthCheckTimeout"`
+		DiscordWebHookDisable    bool                `yaml:"discordWebhookDisable"`
+		DiscordWebHookURL        string              `yaml:"discordWebhookUrl" secret:"true"`
+		DiscordThreadID          string              `yaml:"discordThreadId"`
+		DiscordUsername          string              `yaml:"discordUsername"`
+		DiscordAvatarURL         string              `yaml:"discordAvatarUrl"`
+		DiscordMentions          map[string][]string `yaml:"discordMentions"`
+		DiscordEditOnRecovery    bool                `yaml:"discordEditOnRecovery"`
+		LogFileSize              string              `yaml:"logFileSize"`
+		MaxLogFileKeep           int                 `yaml:"maxLogFileKeep"`
+		SmtpDisable              bool                `yaml:"smtpDisable"`
+		SmtpHost                 string              `yaml:"smtpHost"`
+		SmtpPort                 string              `yaml:"smtpPort"`
+		SmtpUsername             string              `yaml:"smtpUsername"`
+		SmtpPassword             string              `yaml:"smtpPassword" secret:"true"`
+		SmtpFrom                 string              `yaml:"smtpFrom"`
+		SmtpTo                   string              `yaml:"smtpTo"`
+		SmtpCc                   string              `yaml:"smtpCc"`
+		SmtpBcc                  string              `yaml:"smtpBcc"`
+		SmtpTLS                  string              `yaml:"smtpTls"`
+		SmtpAuth                 string              `yaml:"smtpAuth"`
+		PagerDutyEnable          bool                `yaml:"pagerDutyEnable"`
+		PagerDutyRoutingKey      string              `yaml:"pagerDutyRoutingKey" secret:"true"`
+		PagerDutyURL             string              `yaml:"pagerDutyUrl"`
+		AlertmanagerEnable       bool                `yaml:"alertmanagerEnable"`
+		AlertmanagerURL          string              `yaml:"alertmanagerUrl"`
+		OpsgenieEnable           bool                `yaml:"opsgenieEnable"`
+		OpsgenieAPIKey           string              `yaml:"opsgenieApiKey" secret:"true"`
+		OpsgenieURL              string              `yaml:"opsgenieUrl"`
+		OpsgeniePriority         string              `yaml:"opsgeniePriority"`
+		WebhookEnable            bool                `yaml:"webhookEnable"`
+		WebhookURL               string              `yaml:"webhookUrl" secret:"true"`
+		WebhookMethod            string              `yaml:"webhookMethod"`
+		WebhookHeaders           map[string]string   `yaml:"webhookHeaders" secret:"true"`
+		WebhookBody              string              `yaml:"webhookBody"`
+		MatrixEnable             bool                `yaml:"matrixEnable"`
+		MatrixHomeserverURL      string              `yaml:"matrixHomeserverUrl"`
+		MatrixAccessToken        string              `yaml:"matrixAccessToken" secret:"true"`
+		MatrixRoomID             string              `yaml:"matrixRoomId"`
+		Templates                map[string]string   `yaml:"templates"`
+		StateDirectory           string              `yaml:"stateDirectory"`
+		APIEnable                bool                `yaml:"apiEnable"`
+		APIListen                string              `yaml:"apiListen"`
+		APIToken                 string              `yaml:"apiToken" secret:"true"`
+		DigestWindow             int                 `yaml:"digestWindow"`
+		DigestMaxEvents          int                 `yaml:"digestMaxEvents"`
+		QueueMaxAttempts         int                 `yaml:"queueMaxAttempts"`
+		StatusSocket             string              `yaml:"statusSocket"`
+		StatusSocketDisable      bool                `yaml:"statusSocketDisable"`
 	} `yaml:"configuration"`
+
+	Notifiers          []NotifierConfig          `yaml:"notifiers"`
+	Routes             []RouteConfig             `yaml:"routes"`
+	DefaultRoute       RouteConfig               `yaml:"defaultRoute"`
+	EscalationPolicies []EscalationPolicyConfig  `yaml:"escalationPolicies"`
+	SecretProviders    SecretProvidersConfig     `yaml:"secretProviders"`
+	Include            []string                  `yaml:"include"`
+	Defaults           TargetDefaults            `yaml:"defaults"`
+	Templates          map[string]TargetTemplate `yaml:"templates"`
 }
 
 type CronSchedule struct {
@@ -76,6 +106,11 @@ func ParseHealthCron(expression string) (*CronSchedule, error) {
 	if len(fields) != 5 {
 		return nil, errors.New("invalid cron expression: must have 5 fields")
 	}
+	for i, field := range fields {
+		if err := validateCronField(field, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %v", err)
+		}
+	}
 
 	return &CronSchedule{
 		Minute:     fields[0],
@@ -86,12 +121,79 @@ func ParseHealthCron(expression string) (*CronSchedule, error) {
 	}, nil
 }
 
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func validateCronField(field string, bounds cronField) error {
+	inRange := func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s field %q is not a number", bounds.name, value)
+		}
+		if n < bounds.min || n > bounds.max {
+			return fmt.Errorf("%s field %d is out of range %d-%d", bounds.name, n, bounds.min, bounds.max)
+		}
+		return nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		switch {
+		case part == "*":
+		case strings.Contains(part, "/"):
+			stepParts := strings.SplitN(part, "/", 2)
+			if stepParts[0] != "*" {
+				if err := inRange(stepParts[0]); err != nil {
+					return err
+				}
+			}
+			step, err := strconv.Atoi(stepParts[1])
+			if err != nil || step <= 0 || step > bounds.max {
+				return fmt.Errorf("%s field has invalid step %q", bounds.name, stepParts[1])
+			}
+		case strings.Contains(part, "-"):
+			rangeParts := strings.SplitN(part, "-", 2)
+			if err := inRange(rangeParts[0]); err != nil {
+				return err
+			}
+			if err := inRange(rangeParts[1]); err != nil {
+				return err
+			}
+			start, _ := strconv.Atoi(rangeParts[0])
+			end, _ := strconv.Atoi(rangeParts[1])
+			if start > end {
+				return fmt.Errorf("%s field range %s is reversed", bounds.name, part)
+			}
+		default:
+			if err := inRange(part); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *CronSchedule) Match(t time.Time) bool {
 	return c.matchField(c.Minute, t.Minute()) &&
 		c.matchField(c.Hour, t.Hour()) &&
 		c.matchField(c.DayOfMonth, t.Day()) &&
 		c.matchField(c.Month, int(t.Month())) &&
-		c.matchField(c.DayOfWeek, int(t.Weekday()))
+		c.matchDayOfWeek(t.Weekday())
+}
+
+// matchDayOfWeek matches Sunday as both 0 and 7, like cron does.
+func (c *CronSchedule) matchDayOfWeek(day time.Weekday) bool {
+	return c.matchField(c.DayOfWeek, int(day)) ||
+		(day == time.Sunday && c.matchField(c.DayOfWeek, 7))
 }
 
 func (c *CronSchedule) matchField(field string, value int) bool {
@@ -183,7 +285,7 @@ func (sl *SafeLogger) Log(logType, message, event string) {
 		return
 	}
 
-	logEntry, err := CreateLogEntry(logType, message, event)
+	logEntry, err := CreateLogEntry(logType, Redact(message), event)
 	if err != nil {
 		fmt.Printf("Error creating log entry: %v\n", err)
 		return
@@ -345,129 +447,64 @@ func (sl *SafeLogger) RotateLogFile(logPath string, logName string, maxSize int6
 func ConsoleAndLoggerOutput(logger *SafeLogger, logType string, message string, event string) {
 	logger.Log(logType, message, event)
 	if logType == "ERROR" {
-		fmt.Printf("Error: %s\n", message)
+		fmt.Printf("Error: %s\n", Redact(message))
 	}
 }
 
+// LoadConfig reads a configuration file with the files it includes, or every
+// .yaml and .yml file of a directory, expanding ${VAR} references and reading
+// <key>File settings, and registers every secret in it for redaction.
 func LoadConfig(filename string) (*Config, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	decoder := yaml.NewDecoder(file)
-	config := &Config{}
-	err = decoder.Decode(config)
-	if err != nil {
-		return nil, err
+	source, problems := loadSource(filename)
+	if len(problems) == 0 {
+		var config *Config
+		if config, problems = source.decode(); len(problems) == 0 {
+			registerSecrets(reflect.ValueOf(config))
+			return config, nil
+		}
 	}
-	return config, nil
+	return nil, joinProblems(problems)
 }
 
 func ParseConfig(pathToConfig string) *Config {
 	config, err := LoadConfig(pathToConfig)
 	if err != nil {
-		panic(err)
+		log.Fatalf("could not read configuration: %v", err)
 	}
 	return config
 }
 
-func validateICMPField(field, value string, index int) error {
-	if value == "" {
-		return fmt.Errorf("icmp config at index %d has empty %s", index, field)
-	}
-	return nil
-}
-
-func ValidateICMPConfig(icmpConfig []struct {
-	Address        string `yaml:"address"`
-	Service        string `yaml:"service"`
-	Timeout        int    `yaml:"timeout"`
-	FailureTimeout int    `yaml:"failureTimeout"`
-	RetryBuffer    int    `yaml:"retryBuffer"`
-	NetworkZone    string `yaml:"networkZone"`
-	InstanceType   string `yaml:"instanceType"`
-}) error {
-	addresses := make(map[string]bool)
+// ValidateICMPConfig checks every ICMP target and that no two share an id.
+func ValidateICMPConfig(icmpConfig []ICMPTarget) error {
+	ids := make(map[string]bool)
 	for i, icmp := range icmpConfig {
-		if err := validateICMPField("address", icmp.Address, i); err != nil {
+		if err := icmp.Validate(i); err != nil {
 			return err
 		}
-		if err := validateICMPField("service", icmp.Service, i); err != nil {
+		if err := validateTargetID("icmp", i, icmp.ID, icmp.Address, ids); err != nil {
 			return err
 		}
-		if err := validateICMPField("networkZone", icmp.NetworkZone, i); err != nil {
-			return err
-		}
-		if err := validateICMPField("instanceType", icmp.InstanceType, i); err != nil {
-			return err
-		}
-
-		if icmp.Timeout <= 0 {
-			return fmt.Errorf("icmp config at index %d has invalid timeout value (should be positive)", i)
-		}
-		if icmp.FailureTimeout <= 0 {
-			return fmt.Errorf("icmp config at index %d has invalid failureTimeout value (should be positive)", i)
-		}
-		if icmp.RetryBuffer < 0 {
-			return fmt.Errorf("icmp config at index %d has invalid retrybuffer value (should be non-negative)", i)
-		}
-
-		if _, exists := addresses[icmp.Address]; exists {
-			return fmt.Errorf("icmp config at index %d has duplicate address: %s", i, icmp.Address)
-		}
-		addresses[icmp.Address] = true
 	}
 	return nil
 }
 
-func validateNumericField(field string, value, minValue int, index int) error {
+func validateNumericField(protocol string, field string, value, minValue int, index int) error {
 	if value < minValue {
-		return fmt.Errorf("http config at index %d has invalid %s value (should be >= %d)", index, field, minValue)
+		return fmt.Errorf("%s config at index %d has invalid %s value (should be >= %d)", protocol, index, field, minValue)
 	}
 	return nil
 }
 
-func ValidateHTTPConfig(httpConfig []struct {
-	Address        string `yaml:"address"`
-	Service        string `yaml:"service"`
-	Timeout        int    `yaml:"timeout"`
-	FailureTimeout int    `yaml:"failureTimeout"`
-	SkipVerify     bool   `yaml:"skipVerify"`
-	RetryBuffer    int    `yaml:"retryBuffer"`
-	NetworkZone    string `yaml:"networkZone"`
-	InstanceType   string `yaml:"instanceType"`
-}) error {
-	addresses := make(map[string]bool)
+// ValidateHTTPConfig checks every HTTP target and that no two share an id.
+func ValidateHTTPConfig(httpConfig []HTTPTarget) error {
+	ids := make(map[string]bool)
 	for i, http := range httpConfig {
-		if err := validateICMPField("address", http.Address, i); err != nil {
-			return err
-		}
-		if err := validateICMPField("service", http.Service, i); err != nil {
+		if err := http.Validate(i); err != nil {
 			return err
 		}
-		if err := validateICMPField("networkZone", http.NetworkZone, i); err != nil {
+		if err := validateTargetID("http", i, http.ID, http.Address, ids); err != nil {
 			return err
 		}
-		if err := validateICMPField("instanceType", http.InstanceType, i); err != nil {
-			return err
-		}
-
-		if err := validateNumericField("timeout", http.Timeout, 1, i); err != nil {
-			return err
-		}
-		if err := validateNumericField("failureTimeout", http.FailureTimeout, 1, i); err != nil {
-			return err
-		}
-		if err := validateNumericField("retryBuffer", http.RetryBuffer, 0, i); err != nil {
-			return err
-		}
-
-		if _, exists := addresses[http.Address]; exists {
-			return fmt.Errorf("http config at index %d has duplicate address: %s", i, http.Address)
-		}
-		addresses[http.Address] = true
 	}
 	return nil
 }
@@ -476,15 +513,22 @@ func ValidateConfiguration(config *Config) error {
 	if !config.Configuration.DiscordWebHookDisable && config.Configuration.DiscordWebHookURL == "" {
 		return fmt.Errorf("discordWebhookUrl cannot be empty when discordWebhookDisable is false")
 	}
+	if !config.Configuration.DiscordWebHookDisable {
+		if err := validateDiscordOptions(config.Configuration.DiscordThreadID, config.Configuration.DiscordAvatarURL, config.Configuration.DiscordMentions); err != nil {
+			return fmt.Errorf("discord configuration is invalid: %v", err)
+		}
+	}
 
 	if !config.Configuration.SmtpDisable {
 		smtpFields := map[string]string{
-			"smtpFrom":     config.Configuration.SmtpFrom,
-			"smtpTo":       config.Configuration.SmtpTo,
-			"smtpHost":     config.Configuration.SmtpHost,
-			"smtpPort":     config.Configuration.SmtpPort,
-			"smtpUsername": config.Configuration.SmtpUsername,
-			"smtpPassword": config.Configuration.SmtpPassword,
+			"smtpFrom": config.Configuration.SmtpFrom,
+			"smtpTo":   config.Configuration.SmtpTo,
+			"smtpHost": config.Configuration.SmtpHost,
+			"smtpPort": config.Configuration.SmtpPort,
+		}
+		if strings.ToLower(config.Configuration.SmtpAuth) != "none" {
+			smtpFields["smtpUsername"] = config.Configuration.SmtpUsername
+			smtpFields["smtpPassword"] = config.Configuration.SmtpPassword
 		}
 
 		for field, value := range smtpFields {
@@ -496,14 +540,122 @@ func ValidateConfiguration(config *Config) error {
 		if err := validateEmail(config.Configuration.SmtpFrom); err != nil {
 			return fmt.Errorf("smtpFrom is invalid: %v", err)
 		}
-		if err := validateEmail(config.Configuration.SmtpTo); err != nil {
+		if err := validateEmailList(config.Configuration.SmtpTo); err != nil {
 			return fmt.Errorf("smtpTo is invalid: %v", err)
 		}
+		if config.Configuration.SmtpCc != "" {
+			if err := validateEmailList(config.Configuration.SmtpCc); err != nil {
+				return fmt.Errorf("smtpCc is invalid: %v", err)
+			}
+		}
+		if config.Configuration.SmtpBcc != "" {
+			if err := validateEmailList(config.Configuration.SmtpBcc); err != nil {
+				return fmt.Errorf("smtpBcc is invalid: %v", err)
+			}
+		}
+		switch strings.ToLower(config.Configuration.SmtpTLS) {
+		case "", "none", "starttls", "implicit":
+		default:
+			return fmt.Errorf("smtpTls must be one of none, starttls, implicit")
+		}
+		switch strings.ToLower(config.Configuration.SmtpAuth) {
+		case "", "none", "plain", "login", "cram-md5":
+		default:
+			return fmt.Errorf("smtpAuth must be one of none, plain, login, cram-md5")
+		}
 		if err := validatePort(config.Configuration.SmtpPort); err != nil {
 			return fmt.Errorf("smtpPort is invalid: %v", err)
 		}
 	}
 
+	if config.Configuration.PagerDutyEnable {
+		if config.Configuration.PagerDutyURL != "" {
+			if err := validateURL(config.Configuration.PagerDutyURL); err != nil {
+				return fmt.Errorf("pagerDutyUrl is invalid: %v", err)
+			}
+		}
+	}
+
+	if config.Configuration.AlertmanagerEnable {
+		if config.Configuration.AlertmanagerURL == "" {
+			return fmt.Errorf("alertmanagerUrl cannot be empty when alertmanagerEnable is true")
+		}
+		if err := validateURL(config.Configuration.AlertmanagerURL); err != nil {
+			return fmt.Errorf("alertmanagerUrl is invalid: %v", err)
+		}
+	}
+
+	if config.Configuration.OpsgenieEnable {
+		if config.Configuration.OpsgenieAPIKey == "" {
+			return fmt.Errorf("opsgenieApiKey cannot be empty when opsgenieEnable is true")
+		}
+		if config.Configuration.OpsgenieURL != "" {
+			if err := validateURL(config.Configuration.OpsgenieURL); err != nil {
+				return fmt.Errorf("opsgenieUrl is invalid: %v", err)
+			}
+		}
+		switch config.Configuration.OpsgeniePriority {
+		case "", "P1", "P2", "P3", "P4", "P5":
+		default:
+			return fmt.Errorf("opsgeniePriority must be one of P1, P2, P3, P4, P5")
+		}
+	}
+
+	if config.Configuration.WebhookEnable {
+		if config.Configuration.WebhookURL == "" {
+			return fmt.Errorf("webhookUrl cannot be empty when webhookEnable is true")
+		}
+		switch strings.ToUpper(config.Configuration.WebhookMethod) {
+		case "", "GET", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return fmt.Errorf("webhookMethod must be one of GET, POST, PUT, PATCH, DELETE")
+		}
+	}
+
+	if config.Configuration.MatrixEnable {
+		matrixFields := map[string]string{
+			"matrixHomeserverUrl": config.Configuration.MatrixHomeserverURL,
+			"matrixAccessToken":   config.Configuration.MatrixAccessToken,
+			"matrixRoomId":        config.Configuration.MatrixRoomID,
+		}
+		for field, value := range matrixFields {
+			if value == "" {
+				return fmt.Errorf("%s cannot be empty when matrixEnable is true", field)
+			}
+		}
+		if err := validateURL(config.Configuration.MatrixHomeserverURL); err != nil {
+			return fmt.Errorf("matrixHomeserverUrl is invalid: %v", err)
+		}
+		if !strings.HasPrefix(config.Configuration.MatrixRoomID, "!") || !strings.Contains(config.Configuration.MatrixRoomID, ":") {
+			return fmt.Errorf("matrixRoomId must be a room id in the form !opaque:server")
+		}
+	}
+
+	if config.Configuration.StateDirectory != "" {
+		info, err := os.Stat(config.Configuration.StateDirectory)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("stateDirectory must be an existing directory: %s", config.Configuration.StateDirectory)
+		}
+	}
+
+	if config.Configuration.StatusSocket != "" && !config.Configuration.StatusSocketDisable {
+		info, err := os.Stat(filepath.Dir(config.Configuration.StatusSocket))
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("statusSocket must be in an existing directory: %s", config.Configuration.StatusSocket)
+		}
+	}
+
+	if config.Configuration.APIEnable && config.Configuration.APIListen != "" {
+		host, _, err := net.SplitHostPort(config.Configuration.APIListen)
+		if err != nil {
+			return fmt.Errorf("apiListen must be a host:port address: %s", config.Configuration.APIListen)
+		}
+		ip := net.ParseIP(host)
+		if host != "localhost" && (ip == nil || !ip.IsLoopback()) && config.Configuration.APIToken == "" {
+			return fmt.Errorf("apiToken cannot be empty when apiListen is not a loopback address")
+		}
+	}
+
 	if !config.Configuration.Stdout {
 		if config.Configuration.LogFileSize == "" {
 			return fmt.Errorf("logFileSize cannot be empty when stdOut is false")
@@ -516,10 +668,20 @@ func ValidateConfiguration(config *Config) error {
 	if config.Configuration.HealthCron != "" {
 		_, err := ParseHealthCron(config.Configuration.HealthCron)
 		if err != nil {
-			return fmt.Errorf("invalid cron expression: %v", err)
+			return fmt.Errorf("healthCron is invalid: %v", err)
 		}
 	}
 
+	if config.Configuration.DigestWindow < 0 {
+		return fmt.Errorf("digestWindow must not be negative")
+	}
+	if config.Configuration.DigestMaxEvents < 0 {
+		return fmt.Errorf("digestMaxEvents must not be negative")
+	}
+	if config.Configuration.QueueMaxAttempts < 0 {
+		return fmt.Errorf("queueMaxAttempts must not be negative")
+	}
+
 	if config.Configuration.HealthCheckTimeout <= 0 {
 		return fmt.Errorf("healthCheckTimeout must be greater than 0")
 	}
@@ -530,6 +692,12 @@ func ValidateConfiguration(config *Config) error {
 	if err := ValidateHTTPConfig(config.HTTP); err != nil {
 		return fmt.Errorf("HTTP config validation failed: %v", err)
 	}
+	if err := validateTargetIDs(config); err != nil {
+		return err
+	}
+	if err := ValidateNotifiersConfig(config); err != nil {
+		return fmt.Errorf("notifier config validation failed: %v", err)
+	}
 
 	return nil
 }
@@ -542,6 +710,22 @@ func validatePort(port string) error {
 	return nil
 }
 
+func validateURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https url: %s", rawURL)
+	}
+	return nil
+}
+
+func validateEmailList(emails string) error {
+	_, err := mail.ParseAddressList(emails)
+	if err != nil {
+		return fmt.Errorf("invalid email address list: %s", emails)
+	}
+	return nil
+}
+
 func validateEmail(email string) error {
 	_, err := mail.ParseAddress(email)
 	if err != nil {
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultVaultAppRoleMount = "approle"
+
+type vaultErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+type vaultLoginResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+type vaultSecretResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// VaultProvider reads secrets from the KV version 2 secrets engine. References
+// are <mount>/<path>#<key>, e.g. secret/inframon#smtp_password for the key
+// smtp_password of the secret inframon in the engine mounted at secret.
+type VaultProvider struct {
+	config  VaultConfig
+	client  *http.Client
+	mu      sync.Mutex
+	token   string
+	secrets map[string]map[string]interface{}
+}
+
+func NewVaultProvider(config VaultConfig) (*VaultProvider, error) {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("address cannot be empty when VAULT_ADDR is not set")
+	}
+	if err := validateURL(config.Address); err != nil {
+		return nil, fmt.Errorf("address is invalid: %v", err)
+	}
+	if config.Token == "" && config.RoleID == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.Token == "" && (config.RoleID == "" || config.SecretID == "") {
+		return nil, fmt.Errorf("token, or roleId and secretId, must be set")
+	}
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = DefaultVaultAppRoleMount
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	RegisterSecret(config.Token)
+	return &VaultProvider{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		token:   config.Token,
+		secrets: make(map[string]map[string]interface{}),
+	}, nil
+}
+
+func (p *VaultProvider) Scheme() string { return "vault" }
+
+func (p *VaultProvider) Resolve(reference string) (string, error) {
+	path, key, ok := strings.Cut(reference, "#")
+	mount, secret, hasMount := strings.Cut(path, "/")
+	if !ok || key == "" || !hasMount || mount == "" || secret == "" {
+		return "", fmt.Errorf("invalid vault reference %s, expected vault:<mount>/<path>#<key>", reference)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, ok := p.secrets[path]
+	if !ok {
+		if err := p.login(); err != nil {
+			return "", err
+		}
+		var response vaultSecretResponse
+		if err := p.do(http.MethodGet, "/v1/"+mount+"/data/"+secret, nil, &response); err != nil {
+			return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+		}
+		data = response.Data.Data
+		p.secrets[path] = data
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("vault secret %s key %s cannot be used as a value: %w", path, key, err)
+	}
+	return string(encoded), nil
+}
+
+// login exchanges the AppRole credentials for a token the first time one is
+// needed. Callers hold p.mu.
+func (p *VaultProvider) login() error {
+	if p.token != "" {
+		return nil
+	}
+	var response vaultLoginResponse
+	body := map[string]string{"role_id": p.config.RoleID, "secret_id": p.config.SecretID}
+	if err := p.do(http.MethodPost, "/v1/auth/"+p.config.AppRoleMount+"/login", body, &response); err != nil {
+		return fmt.Errorf("vault approle login failed: %w", err)
+	}
+	if response.Auth.ClientToken == "" {
+		return fmt.Errorf("vault approle login failed: no token returned")
+	}
+	p.token = response.Auth.ClientToken
+	RegisterSecret(p.token)
+	return nil
+}
+
+func (p *VaultProvider) do(method string, path string, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, p.config.Address+(&url.URL{Path: path}).EscapedPath(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr vaultErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("%s (status %d)", strings.Join(vaultErr.Errors, ", "), resp.StatusCode)
+		}
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}